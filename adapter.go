@@ -0,0 +1,83 @@
+package socketio
+
+import (
+	"sync"
+)
+
+// AdapterEventCallback receives the room and, for "join-room" and
+// "leave-room", the id of the socket.
+type AdapterEventCallback func(room string, id string)
+
+type adapterEvent struct {
+	sync.RWMutex
+	list map[string][]AdapterEventCallback
+}
+
+func (l *adapterEvent) set(event string, callback AdapterEventCallback) {
+	l.Lock()
+	l.list[event] = append(l.list[event], callback)
+	l.Unlock()
+}
+
+func (l *adapterEvent) get(event string) []AdapterEventCallback {
+	l.RLock()
+	defer l.RUnlock()
+	ret := make([]AdapterEventCallback, 0)
+	ret = append(ret, l.list[event]...)
+	return ret
+}
+
+// Adapter manages the rooms of a namespace. Like the in-memory adapter of
+// the JavaScript server it emits "create-room", "delete-room", "join-room"
+// and "leave-room".
+type Adapter struct {
+	nps       *Namespace
+	listeners adapterEvent
+}
+
+func newAdapter(nps *Namespace) *Adapter {
+	return &Adapter{
+		nps: nps,
+		listeners: adapterEvent{
+			list: make(map[string][]AdapterEventCallback),
+		},
+	}
+}
+
+func (a *Adapter) On(event string, fn AdapterEventCallback) {
+	a.listeners.set(event, fn)
+}
+
+// Rooms returns the names of the rooms that have at least one socket.
+func (a *Adapter) Rooms() []string {
+	return a.nps.rooms.names()
+}
+
+func (a *Adapter) emit(event string, room string, id string) {
+	for _, callback := range a.listeners.get(event) {
+		callback(room, id)
+	}
+}
+
+func (a *Adapter) addToRoom(room string, socket *Socket) {
+	var created bool
+	if !socket.rooms.add(room, func() { created = a.nps.rooms.join(room, socket) }) {
+		return
+	}
+	if created {
+		a.emit("create-room", room, "")
+	}
+	a.emit("join-room", room, socket.Id)
+}
+
+func (a *Adapter) removeFromRoom(room string, socket *Socket) bool {
+	var deleted bool
+	if !socket.rooms.remove(room, func() { deleted = a.nps.rooms.leave(room, socket.Id) }) {
+		return false
+	}
+	a.emit("leave-room", room, socket.Id)
+	if deleted {
+		a.emit("delete-room", room, "")
+	}
+	return true
+}
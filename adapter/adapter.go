@@ -0,0 +1,56 @@
+// Package adapter defines how the Socket.IO servers of a cluster talk to
+// each other. A Bus carries Messages between nodes; the message types follow
+// the cluster adapter of the JavaScript server.
+package adapter
+
+import (
+	"encoding/json"
+	"strconv"
+)
+
+type MessageType int
+
+const (
+	INITIAL_HEARTBEAT MessageType = iota + 1
+	HEARTBEAT
+	BROADCAST
+	SOCKETS_JOIN
+	SOCKETS_LEAVE
+	DISCONNECT_SOCKETS
+	FETCH_SOCKETS
+	FETCH_SOCKETS_RESPONSE
+	SERVER_SIDE_EMIT
+	SERVER_SIDE_EMIT_RESPONSE
+	BROADCAST_CLIENT_COUNT
+	BROADCAST_ACK
+	ADAPTER_CLOSE
+	// FETCH_PRESENCE asks the other nodes for the presence members of a
+	// room. It has no counterpart in the JavaScript adapter.
+	FETCH_PRESENCE
+	FETCH_PRESENCE_RESPONSE
+)
+
+func (t MessageType) String() string {
+	return strconv.Itoa(int(t))
+}
+
+// Message is exchanged between nodes. Node is the id of the sender, Nsp the
+// namespace the message applies to and RequestID correlates a response with
+// its request.
+type Message struct {
+	Type      MessageType     `json:"type"`
+	Node      string          `json:"uid"`
+	Nsp       string          `json:"nsp"`
+	RequestID string          `json:"requestId,omitempty"`
+	Data      json.RawMessage `json:"data,omitempty"`
+}
+
+// Bus carries messages between the nodes of a cluster.
+type Bus interface {
+	// Publish sends the message to every other node.
+	Publish(msg Message) error
+	// Subscribe registers the handler of the messages of other nodes.
+	// Messages must be delivered in the order they were published.
+	Subscribe(handler func(msg Message))
+	Close() error
+}
@@ -0,0 +1,114 @@
+package adapter
+
+import (
+	"errors"
+	"sync"
+)
+
+var ErrBusClosed = errors.New("bus closed")
+
+// MemoryHub connects the buses of several servers running in one process,
+// e.g. in tests.
+//
+//	hub := adapter.NewMemoryHub()
+//	io1 := socketio.New(socketio.WithAdapter(hub.Bus()))
+//	io2 := socketio.New(socketio.WithAdapter(hub.Bus()))
+type MemoryHub struct {
+	sync.RWMutex
+	buses []*MemoryBus
+}
+
+func NewMemoryHub() *MemoryHub {
+	return &MemoryHub{}
+}
+
+// Bus returns a new bus attached to the hub.
+func (h *MemoryHub) Bus() *MemoryBus {
+	bus := &MemoryBus{
+		hub:   h,
+		queue: make(chan Message, 1024),
+		done:  make(chan struct{}),
+	}
+	go bus.run()
+	h.Lock()
+	h.buses = append(h.buses, bus)
+	h.Unlock()
+	return bus
+}
+
+func (h *MemoryHub) others(bus *MemoryBus) []*MemoryBus {
+	h.RLock()
+	defer h.RUnlock()
+	ret := make([]*MemoryBus, 0, len(h.buses))
+	for _, b := range h.buses {
+		if b != bus {
+			ret = append(ret, b)
+		}
+	}
+	return ret
+}
+
+func (h *MemoryHub) remove(bus *MemoryBus) {
+	h.Lock()
+	defer h.Unlock()
+	for index, b := range h.buses {
+		if b == bus {
+			h.buses = append(h.buses[:index], h.buses[index+1:]...)
+			return
+		}
+	}
+}
+
+type MemoryBus struct {
+	mu       sync.RWMutex
+	hub      *MemoryHub
+	handlers []func(msg Message)
+	queue    chan Message
+	done     chan struct{}
+	once     sync.Once
+}
+
+func (b *MemoryBus) Publish(msg Message) error {
+	select {
+	case <-b.done:
+		return ErrBusClosed
+	default:
+	}
+	for _, other := range b.hub.others(b) {
+		select {
+		case other.queue <- msg:
+		case <-other.done:
+		}
+	}
+	return nil
+}
+
+func (b *MemoryBus) Subscribe(handler func(msg Message)) {
+	b.mu.Lock()
+	b.handlers = append(b.handlers, handler)
+	b.mu.Unlock()
+}
+
+func (b *MemoryBus) Close() error {
+	b.once.Do(func() {
+		b.hub.remove(b)
+		close(b.done)
+	})
+	return nil
+}
+
+func (b *MemoryBus) run() {
+	for {
+		select {
+		case msg := <-b.queue:
+			b.mu.RLock()
+			handlers := append([]func(msg Message){}, b.handlers...)
+			b.mu.RUnlock()
+			for _, handler := range handlers {
+				handler(msg)
+			}
+		case <-b.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package adapter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryHub(t *testing.T) {
+	hub := NewMemoryHub()
+	a, b, c := hub.Bus(), hub.Bus(), hub.Bus()
+	defer a.Close()
+	defer b.Close()
+	received := map[*MemoryBus]chan Message{}
+	for _, bus := range []*MemoryBus{a, b, c} {
+		messages := make(chan Message, 4)
+		bus.Subscribe(func(msg Message) { messages <- msg })
+		received[bus] = messages
+	}
+
+	if err := a.Publish(Message{Type: BROADCAST, Node: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, bus := range []*MemoryBus{b, c} {
+		select {
+		case msg := <-received[bus]:
+			if msg.Node != "a" {
+				t.Errorf("message from %q", msg.Node)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("message not delivered")
+		}
+	}
+
+	c.Close()
+	if err := c.Publish(Message{Type: BROADCAST, Node: "c"}); err != ErrBusClosed {
+		t.Errorf("Publish on a closed bus = %v, want ErrBusClosed", err)
+	}
+	a.Publish(Message{Type: BROADCAST, Node: "a"})
+	<-received[b]
+	select {
+	case msg := <-received[a]:
+		t.Errorf("bus received its own message %+v", msg)
+	case msg := <-received[c]:
+		t.Errorf("closed bus received %+v", msg)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,53 @@
+package adapter
+
+// BroadcastFlags modify how a packet is delivered.
+type BroadcastFlags struct {
+	Volatile bool `json:"volatile,omitempty"`
+	// Uncompressed skips the permessage-deflate compression.
+	Uncompressed bool `json:"uncompressed,omitempty"`
+}
+
+// BroadcastOptions select the sockets of a namespace. With no rooms and no
+// users every socket is selected. Except lists socket ids and room names to
+// leave out.
+type BroadcastOptions struct {
+	Rooms  []string       `json:"rooms"`
+	Except []string       `json:"except"`
+	Users  []string       `json:"users,omitempty"`
+	Flags  BroadcastFlags `json:"flags"`
+}
+
+// Packet is a Socket.IO packet, e.g. {"type":2,"nsp":"/","data":["event",1]}.
+type Packet struct {
+	Type int           `json:"type"`
+	Nsp  string        `json:"nsp"`
+	Data []interface{} `json:"data"`
+}
+
+// BroadcastData is the payload of a BROADCAST message.
+type BroadcastData struct {
+	Packet Packet           `json:"packet"`
+	Opts   BroadcastOptions `json:"opts"`
+}
+
+// SocketsJoinData is the payload of SOCKETS_JOIN and SOCKETS_LEAVE messages.
+type SocketsJoinData struct {
+	Opts  BroadcastOptions `json:"opts"`
+	Rooms []string         `json:"rooms"`
+}
+
+// DisconnectSocketsData is the payload of a DISCONNECT_SOCKETS message.
+type DisconnectSocketsData struct {
+	Opts  BroadcastOptions `json:"opts"`
+	Close bool             `json:"close"`
+}
+
+// FetchPresenceData is the payload of a FETCH_PRESENCE message.
+type FetchPresenceData struct {
+	Room string `json:"room"`
+}
+
+// FetchSocketsData is the payload of a FETCH_SOCKETS message.
+type FetchSocketsData struct {
+	Opts BroadcastOptions `json:"opts"`
+}
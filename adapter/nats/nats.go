@@ -0,0 +1,328 @@
+// Package nats is an adapter bus over NATS. Messages of a namespace are
+// published on "<prefix>.nsp.<namespace>", heartbeats and cluster requests on
+// "<prefix>.control.<namespace>" and responses to cluster requests on
+// "<prefix>.response.<node>" of the requesting node only.
+//
+// With JetStream, the "<prefix>.nsp.>" messages are kept in a stream read by
+// a durable consumer per node, so that a node resumes where it stopped after
+// a reconnect or a restart. Heartbeats, requests and responses only matter
+// when they are sent and stay on core NATS.
+//
+//	nc, err := nats.Connect(nats.DefaultURL)
+//	bus, err := socketionats.New(socketionats.Config{Conn: nc})
+//	io := socketio.New(socketio.WithAdapter(bus))
+package nats
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/doquangtan/socketio/v4/adapter"
+	"github.com/nats-io/nats.go"
+)
+
+const requestTTL = time.Minute
+
+// nodeHeader carries the id of the sending bus, so that a node skips its own
+// messages.
+const nodeHeader = "Socketio-Node"
+
+type Config struct {
+	// Conn is the NATS connection, owned by the caller: Close does not
+	// close it.
+	Conn *nats.Conn
+	// Prefix of the subjects, "socket.io" by default.
+	Prefix string
+	// JetStream, when set, persists the namespace messages in a stream
+	// instead of publishing them on core NATS only.
+	JetStream *JetStreamConfig
+}
+
+type JetStreamConfig struct {
+	// Stream is created when missing, "SOCKETIO" by default.
+	Stream string
+	// MaxAge bounds how long messages are kept, 2 minutes by default.
+	MaxAge   time.Duration
+	Replicas int
+	// Durable names the consumer of this node and is required. It must be
+	// unique to the node, e.g. not the host name when several processes
+	// share a host, and stable across its restarts to resume from the last
+	// handled message. The consumer of a node away for longer than MaxAge is
+	// deleted.
+	Durable string
+}
+
+type Bus struct {
+	config Config
+	js     nats.JetStreamContext
+	node   string
+
+	mu       sync.RWMutex
+	handlers []func(msg adapter.Message)
+	subs     []*nats.Subscription
+	// stream is the subscription of the JetStream consumer, whose messages
+	// are acknowledged once handled.
+	stream   *nats.Subscription
+	requests map[string]request
+
+	queue   chan *nats.Msg
+	done    chan struct{}
+	once    sync.Once
+	running sync.Once
+}
+
+// request remembers which node sent a request, to route its responses.
+type request struct {
+	node string
+	at   time.Time
+}
+
+var (
+	ErrNoConn    = errors.New("nats: Config.Conn is required")
+	ErrNoDurable = errors.New("nats: JetStreamConfig.Durable is required")
+)
+
+func New(config Config) (*Bus, error) {
+	if config.Conn == nil {
+		return nil, ErrNoConn
+	}
+	if config.JetStream != nil && config.JetStream.Durable == "" {
+		return nil, ErrNoDurable
+	}
+	if config.Prefix == "" {
+		config.Prefix = "socket.io"
+	}
+	id := make([]byte, 16)
+	rand.Read(id)
+	b := &Bus{
+		config:   config,
+		node:     hex.EncodeToString(id),
+		requests: make(map[string]request),
+		queue:    make(chan *nats.Msg, 1024),
+		done:     make(chan struct{}),
+	}
+	for _, subject := range []string{config.Prefix + ".control.>", b.responseSubject(b.node)} {
+		sub, err := config.Conn.ChanSubscribe(subject, b.queue)
+		if err != nil {
+			b.Close()
+			return nil, err
+		}
+		b.subs = append(b.subs, sub)
+	}
+	subject := config.Prefix + ".nsp.>"
+	if config.JetStream != nil {
+		sub, err := b.subscribeStream(subject)
+		if err != nil {
+			b.Close()
+			return nil, err
+		}
+		b.stream = sub
+		b.subs = append(b.subs, sub)
+	} else {
+		sub, err := config.Conn.ChanSubscribe(subject, b.queue)
+		if err != nil {
+			b.Close()
+			return nil, err
+		}
+		b.subs = append(b.subs, sub)
+	}
+	// Listen before the first message of this node can be answered.
+	if err := config.Conn.Flush(); err != nil {
+		b.Close()
+		return nil, err
+	}
+	return b, nil
+}
+
+// subscribeStream creates the stream and the durable consumer of this node
+// when they are missing, then binds to the consumer. Creating the consumer
+// apart keeps Close from deleting it, so that a restarted node resumes from
+// its last acknowledged message.
+func (b *Bus) subscribeStream(subject string) (*nats.Subscription, error) {
+	js, err := b.config.Conn.JetStream()
+	if err != nil {
+		return nil, err
+	}
+	b.js = js
+	c := *b.config.JetStream
+	if c.Stream == "" {
+		c.Stream = "SOCKETIO"
+	}
+	if c.MaxAge <= 0 {
+		c.MaxAge = 2 * time.Minute
+	}
+	c.Durable = consumerName(c.Durable)
+	if _, err := js.StreamInfo(c.Stream); errors.Is(err, nats.ErrStreamNotFound) {
+		_, err = js.AddStream(&nats.StreamConfig{
+			Name:     c.Stream,
+			Subjects: []string{subject},
+			MaxAge:   c.MaxAge,
+			Replicas: c.Replicas,
+		})
+		if err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+	if _, err := js.ConsumerInfo(c.Stream, c.Durable); errors.Is(err, nats.ErrConsumerNotFound) {
+		_, err = js.AddConsumer(c.Stream, &nats.ConsumerConfig{
+			Durable:           c.Durable,
+			DeliverSubject:    b.config.Prefix + ".deliver." + c.Durable,
+			DeliverPolicy:     nats.DeliverNewPolicy,
+			AckPolicy:         nats.AckExplicitPolicy,
+			FilterSubject:     subject,
+			InactiveThreshold: c.MaxAge,
+		})
+		if err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+	return js.ChanSubscribe(subject, b.queue, nats.Bind(c.Stream, c.Durable), nats.ManualAck())
+}
+
+func (b *Bus) Publish(msg adapter.Message) error {
+	select {
+	case <-b.done:
+		return adapter.ErrBusClosed
+	default:
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	m := &nats.Msg{
+		Data:   data,
+		Header: nats.Header{nodeHeader: []string{b.node}},
+	}
+	if node, ok := b.requester(msg); ok {
+		m.Subject = b.responseSubject(node)
+		return b.config.Conn.PublishMsg(m)
+	}
+	if !persisted(msg) {
+		m.Subject = b.config.Prefix + ".control." + subjectToken(msg.Nsp)
+		return b.config.Conn.PublishMsg(m)
+	}
+	m.Subject = b.config.Prefix + ".nsp." + subjectToken(msg.Nsp)
+	if b.js != nil {
+		_, err = b.js.PublishMsg(m)
+		return err
+	}
+	return b.config.Conn.PublishMsg(m)
+}
+
+// persisted tells whether msg goes to the stream: heartbeats and cluster
+// requests are useless once replayed.
+func persisted(msg adapter.Message) bool {
+	switch msg.Type {
+	case adapter.INITIAL_HEARTBEAT, adapter.HEARTBEAT, adapter.ADAPTER_CLOSE:
+		return false
+	}
+	return msg.RequestID == ""
+}
+
+func (b *Bus) Subscribe(handler func(msg adapter.Message)) {
+	b.mu.Lock()
+	b.handlers = append(b.handlers, handler)
+	b.mu.Unlock()
+	// Messages replayed from the stream wait for a handler instead of being
+	// acknowledged unhandled.
+	b.running.Do(func() { go b.run() })
+}
+
+func (b *Bus) Close() error {
+	b.once.Do(func() {
+		close(b.done)
+		b.mu.Lock()
+		for _, sub := range b.subs {
+			sub.Unsubscribe()
+		}
+		b.mu.Unlock()
+	})
+	return nil
+}
+
+func (b *Bus) responseSubject(node string) string {
+	return b.config.Prefix + ".response." + subjectToken(node)
+}
+
+// requester returns the node that sent the request answered by msg.
+func (b *Bus) requester(msg adapter.Message) (string, bool) {
+	if msg.RequestID == "" || !isResponse(msg.Type) {
+		return "", false
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	r, ok := b.requests[msg.RequestID]
+	return r.node, ok
+}
+
+func isResponse(t adapter.MessageType) bool {
+	return t == adapter.FETCH_SOCKETS_RESPONSE || t == adapter.SERVER_SIDE_EMIT_RESPONSE || t == adapter.FETCH_PRESENCE_RESPONSE
+}
+
+func (b *Bus) run() {
+	ticker := time.NewTicker(requestTTL)
+	defer ticker.Stop()
+	for {
+		select {
+		case m := <-b.queue:
+			b.handle(m)
+			if m.Sub == b.stream {
+				m.Ack()
+			}
+		case <-ticker.C:
+			b.mu.Lock()
+			for id, r := range b.requests {
+				if time.Since(r.at) > requestTTL {
+					delete(b.requests, id)
+				}
+			}
+			b.mu.Unlock()
+		case <-b.done:
+			return
+		}
+	}
+}
+
+func (b *Bus) handle(m *nats.Msg) {
+	node := m.Header.Get(nodeHeader)
+	msg := adapter.Message{}
+	if node == b.node || json.Unmarshal(m.Data, &msg) != nil {
+		// Subscriptions echo the messages of this node.
+		return
+	}
+	b.mu.Lock()
+	if msg.RequestID != "" && !isResponse(msg.Type) {
+		b.requests[msg.RequestID] = request{node: node, at: time.Now()}
+	}
+	handlers := append([]func(msg adapter.Message){}, b.handlers...)
+	b.mu.Unlock()
+	for _, handler := range handlers {
+		handler(msg)
+	}
+}
+
+var consumerReplacer = strings.NewReplacer(".", "_", "*", "_", ">", "_", " ", "_", "/", "_", "\\", "_")
+
+// consumerName makes s a valid consumer name.
+func consumerName(s string) string {
+	return consumerReplacer.Replace(s)
+}
+
+var subjectReplacer = strings.NewReplacer("%", "%25", ".", "%2E", "*", "%2A", ">", "%3E", " ", "%20")
+
+// subjectToken escapes a namespace into a single subject token.
+func subjectToken(s string) string {
+	if s == "" {
+		return "_"
+	}
+	return subjectReplacer.Replace(s)
+}
@@ -0,0 +1,175 @@
+package nats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/doquangtan/socketio/v4/adapter"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+)
+
+func runServer(t *testing.T) *server.Server {
+	s, err := server.NewServer(&server.Options{
+		Host:      "127.0.0.1",
+		Port:      -1,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+		NoLog:     true,
+		NoSigs:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Start()
+	if !s.ReadyForConnections(5 * time.Second) {
+		t.Fatal("nats server not ready")
+	}
+	t.Cleanup(s.Shutdown)
+	return s
+}
+
+func connect(t *testing.T, s *server.Server) *nats.Conn {
+	nc, err := nats.Connect(s.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(nc.Close)
+	return nc
+}
+
+func newTestBus(t *testing.T, nc *nats.Conn, js *JetStreamConfig) *Bus {
+	b, err := New(Config{Conn: nc, JetStream: js})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { b.Close() })
+	return b
+}
+
+func subscribe(b *Bus) chan adapter.Message {
+	messages := make(chan adapter.Message, 16)
+	b.Subscribe(func(msg adapter.Message) {
+		messages <- msg
+	})
+	return messages
+}
+
+func expectMessage(t *testing.T, messages chan adapter.Message, node string) adapter.Message {
+	t.Helper()
+	select {
+	case msg := <-messages:
+		if msg.Node != node {
+			t.Fatalf("message from %q, want %q", msg.Node, node)
+		}
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("message not delivered")
+	}
+	return adapter.Message{}
+}
+
+func expectNoMessage(t *testing.T, messages chan adapter.Message) {
+	t.Helper()
+	select {
+	case msg := <-messages:
+		t.Fatalf("unexpected message %+v", msg)
+	case <-time.After(300 * time.Millisecond):
+	}
+}
+
+func TestNodeSetAtConstruction(t *testing.T) {
+	s := runServer(t)
+	a := newTestBus(t, connect(t, s), nil)
+	b := newTestBus(t, connect(t, s), nil)
+	if a.node == "" || a.node == b.node {
+		t.Fatalf("nodes %q and %q", a.node, b.node)
+	}
+}
+
+func TestDurableRequired(t *testing.T) {
+	s := runServer(t)
+	if _, err := New(Config{Conn: connect(t, s), JetStream: &JetStreamConfig{}}); err != ErrNoDurable {
+		t.Fatalf("error = %v, want ErrNoDurable", err)
+	}
+	js, _ := connect(t, s).JetStream()
+	if _, err := js.StreamInfo("SOCKETIO"); err == nil {
+		t.Error("stream created without a durable name")
+	}
+}
+
+func TestExchange(t *testing.T) {
+	for name, js := range map[string]func(durable string) *JetStreamConfig{
+		"core":      func(string) *JetStreamConfig { return nil },
+		"jetstream": func(durable string) *JetStreamConfig { return &JetStreamConfig{Durable: durable} },
+	} {
+		t.Run(name, func(t *testing.T) {
+			s := runServer(t)
+			a := newTestBus(t, connect(t, s), js("a"))
+			b := newTestBus(t, connect(t, s), js("b"))
+			fromA, fromB := subscribe(a), subscribe(b)
+
+			a.Publish(adapter.Message{Type: adapter.BROADCAST, Node: "a", Nsp: "/chat.room"})
+			expectMessage(t, fromB, "a")
+			expectNoMessage(t, fromA)
+
+			// A request is answered to the requesting node only.
+			c := newTestBus(t, connect(t, s), js("c"))
+			fromC := subscribe(c)
+			a.Publish(adapter.Message{Type: adapter.FETCH_SOCKETS, Node: "a", Nsp: "/", RequestID: "1"})
+			expectMessage(t, fromB, "a")
+			expectMessage(t, fromC, "a")
+			b.Publish(adapter.Message{Type: adapter.FETCH_SOCKETS_RESPONSE, Node: "b", Nsp: "/", RequestID: "1"})
+			expectMessage(t, fromA, "b")
+			expectNoMessage(t, fromC)
+		})
+	}
+}
+
+func TestHeartbeatsNotStored(t *testing.T) {
+	s := runServer(t)
+	nc := connect(t, s)
+	a := newTestBus(t, nc, &JetStreamConfig{Durable: "a"})
+	b := newTestBus(t, connect(t, s), &JetStreamConfig{Durable: "b"})
+	fromB := subscribe(b)
+
+	a.Publish(adapter.Message{Type: adapter.HEARTBEAT, Node: "a", Nsp: "/"})
+	a.Publish(adapter.Message{Type: adapter.SERVER_SIDE_EMIT, Node: "a", Nsp: "/", RequestID: "1"})
+	a.Publish(adapter.Message{Type: adapter.BROADCAST, Node: "a", Nsp: "/"})
+	for i := 0; i < 3; i++ {
+		expectMessage(t, fromB, "a")
+	}
+
+	js, _ := nc.JetStream()
+	info, err := js.StreamInfo("SOCKETIO")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.State.Msgs != 1 {
+		t.Errorf("stream holds %d messages, want the broadcast only", info.State.Msgs)
+	}
+}
+
+func TestResumeAfterRestart(t *testing.T) {
+	s := runServer(t)
+	a := newTestBus(t, connect(t, s), &JetStreamConfig{Durable: "a"})
+	nc := connect(t, s)
+	b := newTestBus(t, nc, &JetStreamConfig{Durable: "b"})
+	fromB := subscribe(b)
+
+	a.Publish(adapter.Message{Type: adapter.BROADCAST, Node: "a", Nsp: "/", Data: []byte(`1`)})
+	expectMessage(t, fromB, "a")
+	b.Close()
+	nc.Close()
+
+	a.Publish(adapter.Message{Type: adapter.BROADCAST, Node: "a", Nsp: "/", Data: []byte(`2`)})
+	a.Publish(adapter.Message{Type: adapter.HEARTBEAT, Node: "a", Nsp: "/"})
+
+	b = newTestBus(t, connect(t, s), &JetStreamConfig{Durable: "b"})
+	fromB = subscribe(b)
+	msg := expectMessage(t, fromB, "a")
+	if msg.Type != adapter.BROADCAST || string(msg.Data) != "2" {
+		t.Fatalf("resumed with %+v, want the broadcast sent while away", msg)
+	}
+	expectNoMessage(t, fromB)
+}
@@ -0,0 +1,17 @@
+module github.com/doquangtan/socketio/v4/adapter/postgres
+
+go 1.22.2
+
+require (
+	github.com/doquangtan/socketio/v4 v4.0.0-20261019050225-484fe3a39054
+	github.com/jackc/pgx/v5 v5.6.0
+)
+
+require (
+	github.com/jackc/pgpassfile v1.0.0 // indirect
+	github.com/jackc/pgservicefile v0.0.0-20221227161230-091c0ba34f0a // indirect
+	github.com/jackc/puddle/v2 v2.2.1 // indirect
+	golang.org/x/crypto v0.31.0 // indirect
+	golang.org/x/sync v0.10.0 // indirect
+	golang.org/x/text v0.21.0 // indirect
+)
@@ -0,0 +1,129 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrNoAttachment = errors.New("postgres: attachment not found")
+
+// MemoryDriver is an in-process Driver standing for one database, e.g. in
+// tests: the buses sharing it receive each other's notifications.
+//
+//	driver := postgres.NewMemoryDriver()
+//	bus1, err := postgres.New(postgres.Config{Driver: driver})
+//	bus2, err := postgres.New(postgres.Config{Driver: driver})
+type MemoryDriver struct {
+	sync.Mutex
+	listeners   map[*memoryListener]bool
+	attachments map[int64]memoryAttachment
+	lastID      int64
+	fetched     int
+}
+
+type memoryListener struct {
+	channel string
+	queue   chan string
+}
+
+type memoryAttachment struct {
+	payload   []byte
+	createdAt time.Time
+}
+
+func NewMemoryDriver() *MemoryDriver {
+	return &MemoryDriver{
+		listeners:   make(map[*memoryListener]bool),
+		attachments: make(map[int64]memoryAttachment),
+	}
+}
+
+func (d *MemoryDriver) Notify(ctx context.Context, channel string, payload string) error {
+	d.Lock()
+	defer d.Unlock()
+	for l := range d.listeners {
+		if l.channel != channel {
+			continue
+		}
+		select {
+		case l.queue <- payload:
+		default:
+			// Postgres, too, drops notifications of a listener falling
+			// behind by a full queue.
+		}
+	}
+	return nil
+}
+
+func (d *MemoryDriver) Listen(ctx context.Context, channel string, fn func(payload string)) error {
+	l := &memoryListener{
+		channel: channel,
+		queue:   make(chan string, 1024),
+	}
+	d.Lock()
+	d.listeners[l] = true
+	d.Unlock()
+	go func() {
+		for {
+			select {
+			case payload := <-l.queue:
+				fn(payload)
+			case <-ctx.Done():
+				d.Lock()
+				delete(d.listeners, l)
+				d.Unlock()
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func (d *MemoryDriver) InsertAttachment(ctx context.Context, payload []byte) (int64, error) {
+	d.Lock()
+	defer d.Unlock()
+	d.lastID++
+	d.attachments[d.lastID] = memoryAttachment{
+		payload:   append([]byte{}, payload...),
+		createdAt: time.Now(),
+	}
+	return d.lastID, nil
+}
+
+func (d *MemoryDriver) Attachment(ctx context.Context, id int64) ([]byte, error) {
+	d.Lock()
+	defer d.Unlock()
+	d.fetched++
+	a, ok := d.attachments[id]
+	if !ok {
+		return nil, ErrNoAttachment
+	}
+	return a.payload, nil
+}
+
+func (d *MemoryDriver) DeleteAttachments(ctx context.Context, before time.Time) error {
+	d.Lock()
+	defer d.Unlock()
+	for id, a := range d.attachments {
+		if a.createdAt.Before(before) {
+			delete(d.attachments, id)
+		}
+	}
+	return nil
+}
+
+// Attachments returns the number of attachments stored.
+func (d *MemoryDriver) Attachments() int {
+	d.Lock()
+	defer d.Unlock()
+	return len(d.attachments)
+}
+
+// Fetched returns how many times an attachment was read.
+func (d *MemoryDriver) Fetched() int {
+	d.Lock()
+	defer d.Unlock()
+	return d.fetched
+}
@@ -0,0 +1,106 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PgxDriver is the Driver of a pgx connection pool. LISTEN holds one
+// connection of the pool for as long as the bus runs.
+type PgxDriver struct {
+	pool  *pgxpool.Pool
+	table string
+}
+
+// NewPgxDriver creates the attachments table, "socket_io_attachments" when
+// table is empty, if it does not exist.
+func NewPgxDriver(ctx context.Context, pool *pgxpool.Pool, table string) (*PgxDriver, error) {
+	if table == "" {
+		table = "socket_io_attachments"
+	}
+	d := &PgxDriver{
+		pool:  pool,
+		table: pgx.Identifier{table}.Sanitize(),
+	}
+	_, err := pool.Exec(ctx, `CREATE TABLE IF NOT EXISTS `+d.table+` (
+		id         bigserial UNIQUE,
+		created_at timestamptz DEFAULT NOW(),
+		payload    bytea
+	)`)
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (d *PgxDriver) Notify(ctx context.Context, channel string, payload string) error {
+	_, err := d.pool.Exec(ctx, `SELECT pg_notify($1, $2)`, channel, payload)
+	return err
+}
+
+func (d *PgxDriver) Listen(ctx context.Context, channel string, fn func(payload string)) error {
+	conn, err := d.listen(ctx, channel)
+	if err != nil {
+		return err
+	}
+	go func() {
+		for {
+			if conn != nil {
+				d.wait(ctx, conn, fn)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Second):
+			}
+			conn, _ = d.listen(ctx, channel)
+		}
+	}()
+	return nil
+}
+
+// listen takes a connection out of the pool, as it must not be reused once
+// it listens.
+func (d *PgxDriver) listen(ctx context.Context, channel string) (*pgx.Conn, error) {
+	c, err := d.pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	conn := c.Hijack()
+	if _, err := conn.Exec(ctx, `LISTEN `+pgx.Identifier{channel}.Sanitize()); err != nil {
+		conn.Close(context.Background())
+		return nil, err
+	}
+	return conn, nil
+}
+
+func (d *PgxDriver) wait(ctx context.Context, conn *pgx.Conn, fn func(payload string)) {
+	defer conn.Close(context.Background())
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return
+		}
+		fn(n.Payload)
+	}
+}
+
+func (d *PgxDriver) InsertAttachment(ctx context.Context, payload []byte) (int64, error) {
+	var id int64
+	err := d.pool.QueryRow(ctx, `INSERT INTO `+d.table+` (payload) VALUES ($1) RETURNING id`, payload).Scan(&id)
+	return id, err
+}
+
+func (d *PgxDriver) Attachment(ctx context.Context, id int64) ([]byte, error) {
+	var payload []byte
+	err := d.pool.QueryRow(ctx, `SELECT payload FROM `+d.table+` WHERE id = $1`, id).Scan(&payload)
+	return payload, err
+}
+
+func (d *PgxDriver) DeleteAttachments(ctx context.Context, before time.Time) error {
+	_, err := d.pool.Exec(ctx, `DELETE FROM `+d.table+` WHERE created_at < $1`, before)
+	return err
+}
@@ -0,0 +1,204 @@
+// Package postgres is an adapter bus over Postgres LISTEN/NOTIFY, in the
+// spirit of @socket.io/postgres-adapter. Payloads above the 8000 bytes NOTIFY
+// limit are stored in an attachments table and only their id is notified.
+//
+//	pool, err := pgxpool.New(ctx, "postgres://localhost/app")
+//	driver, err := postgres.NewPgxDriver(ctx, pool, "")
+//	bus, err := postgres.New(postgres.Config{Driver: driver})
+//	io := socketio.New(socketio.WithAdapter(bus))
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/doquangtan/socketio/v4/adapter"
+)
+
+// Driver is the part of Postgres the bus needs, so that it can run on any
+// client library or an in-process fake.
+type Driver interface {
+	// Notify sends the payload on the channel.
+	Notify(ctx context.Context, channel string, payload string) error
+	// Listen returns once the channel is listened to, then calls fn with
+	// every payload notified on it until ctx is done, reconnecting as
+	// needed.
+	Listen(ctx context.Context, channel string, fn func(payload string)) error
+	// InsertAttachment stores a payload too large to be notified.
+	InsertAttachment(ctx context.Context, payload []byte) (int64, error)
+	Attachment(ctx context.Context, id int64) ([]byte, error)
+	// DeleteAttachments removes the attachments created before t.
+	DeleteAttachments(ctx context.Context, before time.Time) error
+}
+
+type Config struct {
+	Driver Driver
+	// Channel notified, "socket.io" by default.
+	Channel string
+	// PayloadThreshold is the size above which payloads are stored as
+	// attachments, 8000 bytes by default.
+	PayloadThreshold int
+	// CleanupInterval between two deletions of the attachments older than
+	// it, 30 seconds by default.
+	CleanupInterval time.Duration
+}
+
+type Bus struct {
+	config Config
+
+	mu       sync.RWMutex
+	handlers []func(msg adapter.Message)
+	// node is the uid of the messages published through the bus, whose
+	// notifications come back to it.
+	node string
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	queue  chan string
+}
+
+// notification is notified instead of a message stored as an attachment.
+type notification struct {
+	Type         adapter.MessageType `json:"type"`
+	Node         string              `json:"uid"`
+	AttachmentID int64               `json:"attachmentId"`
+}
+
+var ErrNoDriver = errors.New("postgres: Config.Driver is required")
+
+func New(config Config) (*Bus, error) {
+	if config.Driver == nil {
+		return nil, ErrNoDriver
+	}
+	if config.Channel == "" {
+		config.Channel = "socket.io"
+	}
+	if config.PayloadThreshold <= 0 {
+		config.PayloadThreshold = 8000
+	}
+	if config.CleanupInterval <= 0 {
+		config.CleanupInterval = 30 * time.Second
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	b := &Bus{
+		config: config,
+		ctx:    ctx,
+		cancel: cancel,
+		queue:  make(chan string, 1024),
+	}
+	err := config.Driver.Listen(ctx, config.Channel, func(payload string) {
+		select {
+		case b.queue <- payload:
+		case <-ctx.Done():
+		}
+	})
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	go b.run()
+	go b.cleanup()
+	return b, nil
+}
+
+func (b *Bus) Publish(msg adapter.Message) error {
+	if b.ctx.Err() != nil {
+		return adapter.ErrBusClosed
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	// The node is known before its first notification can come back.
+	b.mu.Lock()
+	b.node = msg.Node
+	b.mu.Unlock()
+	if len(data) > b.config.PayloadThreshold {
+		id, err := b.config.Driver.InsertAttachment(b.ctx, data)
+		if err != nil {
+			return err
+		}
+		data, _ = json.Marshal(notification{
+			Type:         msg.Type,
+			Node:         msg.Node,
+			AttachmentID: id,
+		})
+	}
+	return b.config.Driver.Notify(b.ctx, b.config.Channel, string(data))
+}
+
+func (b *Bus) Subscribe(handler func(msg adapter.Message)) {
+	b.mu.Lock()
+	b.handlers = append(b.handlers, handler)
+	b.mu.Unlock()
+}
+
+// Close stops listening. The driver, and its connections, are left open.
+func (b *Bus) Close() error {
+	b.cancel()
+	return nil
+}
+
+func (b *Bus) run() {
+	for {
+		select {
+		case payload := <-b.queue:
+			msg, ok := b.decode(payload)
+			if !ok {
+				continue
+			}
+			b.mu.RLock()
+			handlers := append([]func(msg adapter.Message){}, b.handlers...)
+			b.mu.RUnlock()
+			for _, handler := range handlers {
+				handler(msg)
+			}
+		case <-b.ctx.Done():
+			return
+		}
+	}
+}
+
+func (b *Bus) decode(payload string) (adapter.Message, bool) {
+	n := notification{}
+	if json.Unmarshal([]byte(payload), &n) != nil {
+		return adapter.Message{}, false
+	}
+	b.mu.RLock()
+	own := n.Node != "" && n.Node == b.node
+	b.mu.RUnlock()
+	if own {
+		// LISTEN receives the notifications of this node too.
+		return adapter.Message{}, false
+	}
+	data := []byte(payload)
+	if n.AttachmentID != 0 {
+		var err error
+		data, err = b.config.Driver.Attachment(b.ctx, n.AttachmentID)
+		if err != nil {
+			return adapter.Message{}, false
+		}
+	}
+	msg := adapter.Message{}
+	if json.Unmarshal(data, &msg) != nil {
+		return adapter.Message{}, false
+	}
+	return msg, true
+}
+
+// cleanup deletes the attachments every node had time to read.
+func (b *Bus) cleanup() {
+	ticker := time.NewTicker(b.config.CleanupInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			b.config.Driver.DeleteAttachments(b.ctx, time.Now().Add(-b.config.CleanupInterval))
+		case <-b.ctx.Done():
+			return
+		}
+	}
+}
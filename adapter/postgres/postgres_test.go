@@ -0,0 +1,120 @@
+package postgres
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/doquangtan/socketio/v4/adapter"
+)
+
+func newTestBus(t *testing.T, config Config) *Bus {
+	b, err := New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { b.Close() })
+	return b
+}
+
+func subscribe(b *Bus) chan adapter.Message {
+	messages := make(chan adapter.Message, 16)
+	b.Subscribe(func(msg adapter.Message) {
+		messages <- msg
+	})
+	return messages
+}
+
+func expectMessage(t *testing.T, messages chan adapter.Message, node string) adapter.Message {
+	t.Helper()
+	select {
+	case msg := <-messages:
+		if msg.Node != node {
+			t.Fatalf("message from %q, want %q", msg.Node, node)
+		}
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("message not delivered")
+	}
+	return adapter.Message{}
+}
+
+func expectNoMessage(t *testing.T, messages chan adapter.Message) {
+	t.Helper()
+	select {
+	case msg := <-messages:
+		t.Fatalf("unexpected message %+v", msg)
+	case <-time.After(300 * time.Millisecond):
+	}
+}
+
+func TestNoDriver(t *testing.T) {
+	if _, err := New(Config{}); err != ErrNoDriver {
+		t.Fatalf("New error = %v, want ErrNoDriver", err)
+	}
+}
+
+func TestExchange(t *testing.T) {
+	driver := NewMemoryDriver()
+	a := newTestBus(t, Config{Driver: driver})
+	b := newTestBus(t, Config{Driver: driver})
+	other := newTestBus(t, Config{Driver: driver, Channel: "other"})
+	fromA, fromB, fromOther := subscribe(a), subscribe(b), subscribe(other)
+
+	a.Publish(adapter.Message{Type: adapter.BROADCAST, Node: "a", Nsp: "/", Data: []byte(`"hi"`)})
+	msg := expectMessage(t, fromB, "a")
+	if msg.Type != adapter.BROADCAST || string(msg.Data) != `"hi"` {
+		t.Errorf("received %+v", msg)
+	}
+	expectNoMessage(t, fromA)
+	expectNoMessage(t, fromOther)
+	if driver.Attachments() != 0 {
+		t.Errorf("%d attachments for a small payload", driver.Attachments())
+	}
+}
+
+func TestAttachment(t *testing.T) {
+	driver := NewMemoryDriver()
+	a := newTestBus(t, Config{Driver: driver, PayloadThreshold: 100})
+	b := newTestBus(t, Config{Driver: driver, PayloadThreshold: 100})
+	fromA, fromB := subscribe(a), subscribe(b)
+
+	data := []byte(`"` + strings.Repeat("x", 200) + `"`)
+	a.Publish(adapter.Message{Type: adapter.BROADCAST, Node: "a", Nsp: "/", Data: data})
+	msg := expectMessage(t, fromB, "a")
+	if string(msg.Data) != string(data) {
+		t.Errorf("received %d bytes, want %d", len(msg.Data), len(data))
+	}
+	expectNoMessage(t, fromA)
+	if driver.Attachments() != 1 {
+		t.Errorf("%d attachments, want 1", driver.Attachments())
+	}
+	// The sender does not read back its own attachment.
+	if driver.Fetched() != 1 {
+		t.Errorf("attachment read %d times, want 1", driver.Fetched())
+	}
+}
+
+func TestCleanup(t *testing.T) {
+	driver := NewMemoryDriver()
+	a := newTestBus(t, Config{Driver: driver, PayloadThreshold: 10, CleanupInterval: 50 * time.Millisecond})
+	a.Publish(adapter.Message{Type: adapter.BROADCAST, Node: "a", Nsp: "/", Data: []byte(`"0123456789"`)})
+	if driver.Attachments() != 1 {
+		t.Fatalf("%d attachments, want 1", driver.Attachments())
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for driver.Attachments() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("attachment not deleted")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestClose(t *testing.T) {
+	a := newTestBus(t, Config{Driver: NewMemoryDriver()})
+	a.Close()
+	if err := a.Publish(adapter.Message{Type: adapter.BROADCAST, Node: "a"}); err != adapter.ErrBusClosed {
+		t.Fatalf("Publish error = %v, want ErrBusClosed", err)
+	}
+}
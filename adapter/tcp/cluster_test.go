@@ -0,0 +1,119 @@
+package tcp_test
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	socketio "github.com/doquangtan/socketio/v4"
+	"github.com/doquangtan/socketio/v4/adapter/tcp"
+	gWebsocket "github.com/gorilla/websocket"
+)
+
+// dial connects a websocket client to the root namespace of srv.
+func dial(t *testing.T, srv *httptest.Server) *gWebsocket.Conn {
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/socket.io/?EIO=4&transport=websocket"
+	conn, _, err := gWebsocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	read(t, conn)
+	conn.WriteMessage(gWebsocket.TextMessage, []byte("40"))
+	read(t, conn)
+	return conn
+}
+
+func read(t *testing.T, conn *gWebsocket.Conn) string {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, m, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSuffix(string(m), "\n")
+}
+
+func eventually(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestCluster(t *testing.T) {
+	const nodes = 3
+	buses := make([]*tcp.Bus, nodes)
+	peers := make([]string, nodes)
+	for i := range buses {
+		bus, err := tcp.New(tcp.Config{
+			Addr:          "127.0.0.1:0",
+			Secret:        "s3cret",
+			RetryInterval: 20 * time.Millisecond,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		buses[i] = bus
+		peers[i] = bus.Addr().String()
+	}
+	ios := make([]*socketio.Io, nodes)
+	clients := make([]*gWebsocket.Conn, nodes)
+	for i, bus := range buses {
+		for _, addr := range peers {
+			bus.AddPeer(addr)
+		}
+		io := socketio.New(socketio.WithAdapter(bus))
+		io.OnConnection(func(socket *socketio.Socket) {
+			socket.Join("news")
+		})
+		srv := httptest.NewServer(io)
+		t.Cleanup(func() {
+			srv.Close()
+			io.Close()
+		})
+		ios[i] = io
+		clients[i] = dial(t, srv)
+	}
+	eventually(t, func() bool {
+		for _, io := range ios {
+			if io.Of("/").Adapter().ServerCount() != nodes {
+				return false
+			}
+		}
+		return true
+	})
+
+	ios[0].To("news").Emit("headline", "tcp")
+	for i, client := range clients {
+		if got := read(t, client); got != `42["headline","tcp"]` {
+			t.Errorf("client of node %d got %q", i, got)
+		}
+	}
+
+	if sockets := ios[1].FetchSockets(); len(sockets) != nodes {
+		t.Errorf("FetchSockets() = %d sockets, want %d", len(sockets), nodes)
+	}
+
+	ios[2].SocketsJoin("vip")
+	eventually(t, func() bool {
+		return len(ios[0].To("vip").FetchSockets()) == nodes
+	})
+
+	ios[0].DisconnectSockets()
+	for i, client := range clients {
+		if got := read(t, client); got != "41" {
+			t.Errorf("client of node %d got %q, want DISCONNECT", i, got)
+		}
+	}
+	for _, bus := range buses {
+		if dropped := bus.Dropped(); dropped != 0 {
+			t.Errorf("Dropped() = %d", dropped)
+		}
+	}
+}
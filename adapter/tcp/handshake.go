@@ -0,0 +1,95 @@
+package tcp
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net"
+)
+
+// hello is exchanged when a node connects to a peer:
+//
+//	dialer   -> {node, nonce}
+//	listener -> {node, nonce, proof of the dialer nonce}
+//	dialer   -> {node, proof of the listener nonce}
+//
+// Node lets a node dialing itself notice it. A proof is the HMAC of a nonce
+// with the Secret, tagged with the role of the prover so that the proofs of
+// a listener cannot be replayed as the proofs of a dialer.
+type hello struct {
+	Node  string `json:"node"`
+	Nonce string `json:"nonce,omitempty"`
+	Proof string `json:"proof,omitempty"`
+}
+
+func (b *Bus) proof(role string, nonce string) string {
+	mac := hmac.New(sha256.New, []byte(b.config.Secret))
+	mac.Write([]byte(role + ":" + nonce))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (b *Bus) verify(role string, nonce string, proof string) bool {
+	return hmac.Equal([]byte(proof), []byte(b.proof(role, nonce)))
+}
+
+// dialHandshake runs the handshake of the dialing node. self reports that
+// the address turned out to be the node itself.
+func (b *Bus) dialHandshake(conn net.Conn) (ok bool, self bool) {
+	nonce := newNonce()
+	if writeHello(conn, hello{Node: b.id, Nonce: nonce}) != nil {
+		return false, false
+	}
+	h, err := readHello(bufio.NewScanner(conn))
+	if err != nil {
+		return false, false
+	}
+	if h.Node == b.id {
+		return false, true
+	}
+	if !b.verify("listener", nonce, h.Proof) {
+		return false, false
+	}
+	return writeHello(conn, hello{Node: b.id, Proof: b.proof("dialer", h.Nonce)}) == nil, false
+}
+
+// acceptHandshake runs the handshake of the listening node, returning
+// whether the dialing node is another node knowing the Secret.
+func (b *Bus) acceptHandshake(conn net.Conn, scanner *bufio.Scanner) bool {
+	h, err := readHello(scanner)
+	if err != nil {
+		return false
+	}
+	nonce := newNonce()
+	if writeHello(conn, hello{Node: b.id, Nonce: nonce, Proof: b.proof("listener", h.Nonce)}) != nil || h.Node == b.id {
+		return false
+	}
+	h, err = readHello(scanner)
+	return err == nil && b.verify("dialer", nonce, h.Proof)
+}
+
+func newNonce() string {
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	return hex.EncodeToString(nonce)
+}
+
+func writeHello(conn net.Conn, h hello) error {
+	line, _ := json.Marshal(h)
+	_, err := conn.Write(append(line, '\n'))
+	return err
+}
+
+func readHello(scanner *bufio.Scanner) (hello, error) {
+	h := hello{}
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return h, err
+		}
+		return h, io.ErrUnexpectedEOF
+	}
+	return h, json.Unmarshal(scanner.Bytes(), &h)
+}
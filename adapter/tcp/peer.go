@@ -0,0 +1,106 @@
+package tcp
+
+import (
+	"crypto/tls"
+	"net"
+	"sync"
+	"time"
+)
+
+// peer is an outbound connection to another node, redialed until the peer
+// is removed.
+type peer struct {
+	addr  string
+	bus   *Bus
+	queue chan []byte
+	// pending is the line whose write failed, sent again first once the
+	// peer is reconnected.
+	pending []byte
+	done    chan struct{}
+	once    sync.Once
+}
+
+func (p *peer) send(line []byte) {
+	select {
+	case p.queue <- line:
+	default:
+		p.bus.dropped.Add(1)
+	}
+}
+
+func (p *peer) stop() {
+	p.once.Do(func() {
+		close(p.done)
+	})
+}
+
+func (p *peer) run() {
+	for {
+		conn, self := p.dial()
+		if self {
+			p.bus.removeSelf(p)
+			return
+		}
+		if conn != nil {
+			p.write(conn)
+			conn.Close()
+		}
+		select {
+		case <-p.done:
+			return
+		case <-time.After(p.bus.config.RetryInterval):
+		}
+	}
+}
+
+// dial connects and runs the handshake, reporting whether the address turned
+// out to be the node itself.
+func (p *peer) dial() (net.Conn, bool) {
+	var conn net.Conn
+	var err error
+	dialer := &net.Dialer{Timeout: p.bus.config.DialTimeout}
+	if p.bus.config.TLSConfig != nil {
+		conn, err = tls.DialWithDialer(dialer, "tcp", p.addr, p.bus.config.TLSConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", p.addr)
+	}
+	if err != nil {
+		return nil, false
+	}
+	conn.SetDeadline(time.Now().Add(p.bus.config.DialTimeout))
+	ok, self := p.bus.dialHandshake(conn)
+	if !ok {
+		conn.Close()
+		return nil, self
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, false
+}
+
+func (p *peer) write(conn net.Conn) {
+	closed := make(chan struct{})
+	go func() {
+		// The remote node never writes after the handshake; a read
+		// returning means the connection is gone.
+		conn.Read(make([]byte, 1))
+		close(closed)
+	}()
+	for {
+		if p.pending == nil {
+			select {
+			case p.pending = <-p.queue:
+			case <-closed:
+				return
+			case <-p.done:
+				return
+			}
+		}
+		// A timed out write may have sent part of the line: the connection
+		// is closed, so the peer drops it, and the line is sent again whole.
+		conn.SetWriteDeadline(time.Now().Add(p.bus.config.WriteTimeout))
+		if _, err := conn.Write(p.pending); err != nil {
+			return
+		}
+		p.pending = nil
+	}
+}
@@ -0,0 +1,328 @@
+// Package tcp is an adapter bus connecting the nodes of a cluster directly
+// over TCP, without a broker. Every node listens on an address and dials
+// each of its peers; messages are sent as newline-delimited JSON.
+//
+// Any client reaching Addr could broadcast to or disconnect the sockets of
+// the cluster: keep the port on a private network, set Secret so that only
+// the nodes sharing it are accepted, and TLSConfig to encrypt the traffic.
+//
+//	bus, err := tcp.New(tcp.Config{
+//		Addr:   ":7946",
+//		Peers:  []string{"10.0.0.2:7946", "10.0.0.3:7946"},
+//		Secret: os.Getenv("CLUSTER_SECRET"),
+//	})
+//	io := socketio.New(socketio.WithAdapter(bus))
+package tcp
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/doquangtan/socketio/v4/adapter"
+)
+
+type Config struct {
+	// Addr is the address the node listens on for its peers, e.g. ":7946".
+	Addr string
+	// Peers are the addresses of the other nodes. Listing the node itself
+	// is harmless, so every node can share the same list.
+	Peers []string
+	// PeersFile is read for more peers, one address per line, and re-read
+	// every RefreshInterval (10 seconds by default).
+	PeersFile       string
+	RefreshInterval time.Duration
+	// DialTimeout defaults to 5 seconds, RetryInterval between two dials of
+	// an unreachable peer to 1 second.
+	DialTimeout   time.Duration
+	RetryInterval time.Duration
+	// WriteTimeout bounds the write of a message to a peer, 10 seconds by
+	// default. A peer that stops reading is disconnected, then redialed.
+	WriteTimeout time.Duration
+	// QueueSize is the number of messages kept for a peer while it is
+	// unreachable, 1024 by default. Newer messages are dropped and counted
+	// by Dropped.
+	QueueSize int
+	// Secret authenticates the nodes: a connection is only accepted when
+	// both ends prove they know it. It does not encrypt the messages.
+	Secret string
+	// TLSConfig encrypts the connections. It is used both to listen and to
+	// dial, so it needs Certificates and the RootCAs of the peers; set
+	// ClientAuth to tls.RequireAndVerifyClientCert to check the dialing
+	// nodes too.
+	TLSConfig *tls.Config
+}
+
+type Bus struct {
+	config   Config
+	id       string
+	listener net.Listener
+
+	mu       sync.RWMutex
+	handlers []func(msg adapter.Message)
+	peers    map[string]*peer
+	// self holds the listed addresses that turned out to be this node.
+	self    map[string]bool
+	inbound map[net.Conn]struct{}
+	dropped atomic.Uint64
+
+	queue chan adapter.Message
+	done  chan struct{}
+	once  sync.Once
+}
+
+func New(config Config) (*Bus, error) {
+	if config.RefreshInterval <= 0 {
+		config.RefreshInterval = 10 * time.Second
+	}
+	if config.DialTimeout <= 0 {
+		config.DialTimeout = 5 * time.Second
+	}
+	if config.RetryInterval <= 0 {
+		config.RetryInterval = time.Second
+	}
+	if config.WriteTimeout <= 0 {
+		config.WriteTimeout = 10 * time.Second
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = 1024
+	}
+	listener, err := net.Listen("tcp", config.Addr)
+	if err != nil {
+		return nil, err
+	}
+	if config.TLSConfig != nil {
+		listener = tls.NewListener(listener, config.TLSConfig)
+	}
+	id := make([]byte, 16)
+	rand.Read(id)
+	b := &Bus{
+		config:   config,
+		id:       hex.EncodeToString(id),
+		listener: listener,
+		peers:    make(map[string]*peer),
+		self:     make(map[string]bool),
+		inbound:  make(map[net.Conn]struct{}),
+		queue:    make(chan adapter.Message, 1024),
+		done:     make(chan struct{}),
+	}
+	go b.accept()
+	go b.run()
+	b.setPeers(b.peerList())
+	if config.PeersFile != "" {
+		go b.refresh()
+	}
+	return b, nil
+}
+
+// Addr returns the address the bus listens on.
+func (b *Bus) Addr() net.Addr {
+	return b.listener.Addr()
+}
+
+// Dropped returns how many messages were dropped because the queue of an
+// unreachable peer was full.
+func (b *Bus) Dropped() uint64 {
+	return b.dropped.Load()
+}
+
+// AddPeer connects the bus to one more node.
+func (b *Bus) AddPeer(addr string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.addPeer(addr)
+}
+
+func (b *Bus) Publish(msg adapter.Message) error {
+	select {
+	case <-b.done:
+		return adapter.ErrBusClosed
+	default:
+	}
+	line, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, p := range b.peers {
+		p.send(line)
+	}
+	return nil
+}
+
+func (b *Bus) Subscribe(handler func(msg adapter.Message)) {
+	b.mu.Lock()
+	b.handlers = append(b.handlers, handler)
+	b.mu.Unlock()
+}
+
+func (b *Bus) Close() error {
+	var err error
+	b.once.Do(func() {
+		close(b.done)
+		err = b.listener.Close()
+		b.mu.Lock()
+		for addr, p := range b.peers {
+			p.stop()
+			delete(b.peers, addr)
+		}
+		for conn := range b.inbound {
+			conn.Close()
+		}
+		b.mu.Unlock()
+	})
+	return err
+}
+
+func (b *Bus) run() {
+	for {
+		select {
+		case msg := <-b.queue:
+			b.mu.RLock()
+			handlers := append([]func(msg adapter.Message){}, b.handlers...)
+			b.mu.RUnlock()
+			for _, handler := range handlers {
+				handler(msg)
+			}
+		case <-b.done:
+			return
+		}
+	}
+}
+
+func (b *Bus) accept() {
+	for {
+		conn, err := b.listener.Accept()
+		if err != nil {
+			select {
+			case <-b.done:
+				return
+			default:
+			}
+			time.Sleep(b.config.RetryInterval)
+			continue
+		}
+		b.mu.Lock()
+		b.inbound[conn] = struct{}{}
+		b.mu.Unlock()
+		go b.read(conn)
+	}
+}
+
+// read delivers the messages of an inbound connection once the dialing node
+// is authenticated.
+func (b *Bus) read(conn net.Conn) {
+	defer func() {
+		conn.Close()
+		b.mu.Lock()
+		delete(b.inbound, conn)
+		b.mu.Unlock()
+	}()
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	conn.SetDeadline(time.Now().Add(b.config.DialTimeout))
+	if !b.acceptHandshake(conn, scanner) {
+		return
+	}
+	conn.SetDeadline(time.Time{})
+	for scanner.Scan() {
+		msg := adapter.Message{}
+		if json.Unmarshal(scanner.Bytes(), &msg) != nil {
+			continue
+		}
+		select {
+		case b.queue <- msg:
+		case <-b.done:
+			return
+		}
+	}
+}
+
+func (b *Bus) peerList() []string {
+	ret := append([]string{}, b.config.Peers...)
+	if b.config.PeersFile == "" {
+		return ret
+	}
+	data, err := os.ReadFile(b.config.PeersFile)
+	if err != nil {
+		return ret
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			ret = append(ret, line)
+		}
+	}
+	return ret
+}
+
+func (b *Bus) refresh() {
+	ticker := time.NewTicker(b.config.RefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			b.setPeers(b.peerList())
+		case <-b.done:
+			return
+		}
+	}
+}
+
+// setPeers connects to the new addresses and drops the peers no longer
+// listed.
+func (b *Bus) setPeers(addrs []string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	listed := make(map[string]bool, len(addrs))
+	for _, addr := range addrs {
+		listed[addr] = true
+		b.addPeer(addr)
+	}
+	for addr, p := range b.peers {
+		if !listed[addr] {
+			p.stop()
+			delete(b.peers, addr)
+		}
+	}
+}
+
+func (b *Bus) addPeer(addr string) {
+	select {
+	case <-b.done:
+		return
+	default:
+	}
+	if _, ok := b.peers[addr]; ok || b.self[addr] {
+		return
+	}
+	p := &peer{
+		addr:  addr,
+		bus:   b,
+		queue: make(chan []byte, b.config.QueueSize),
+		done:  make(chan struct{}),
+	}
+	b.peers[addr] = p
+	go p.run()
+}
+
+// removeSelf forgets a peer that turned out to be this node, so that Publish
+// stops queueing messages for it and setPeers does not add it back.
+func (b *Bus) removeSelf(p *peer) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.self[p.addr] = true
+	if b.peers[p.addr] == p {
+		delete(b.peers, p.addr)
+	}
+}
@@ -0,0 +1,250 @@
+package tcp
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/doquangtan/socketio/v4/adapter"
+)
+
+func newTestBus(t *testing.T, config Config) *Bus {
+	config.Addr = "127.0.0.1:0"
+	config.RetryInterval = 20 * time.Millisecond
+	b, err := New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { b.Close() })
+	return b
+}
+
+func subscribe(b *Bus) chan adapter.Message {
+	messages := make(chan adapter.Message, 16)
+	b.Subscribe(func(msg adapter.Message) {
+		messages <- msg
+	})
+	return messages
+}
+
+func expectMessage(t *testing.T, messages chan adapter.Message, node string) {
+	t.Helper()
+	select {
+	case msg := <-messages:
+		if msg.Node != node {
+			t.Fatalf("message from %q, want %q", msg.Node, node)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("message not delivered")
+	}
+}
+
+func expectNoMessage(t *testing.T, messages chan adapter.Message) {
+	t.Helper()
+	select {
+	case msg := <-messages:
+		t.Fatalf("unexpected message %+v", msg)
+	case <-time.After(300 * time.Millisecond):
+	}
+}
+
+func TestSecret(t *testing.T) {
+	a := newTestBus(t, Config{Secret: "s3cret"})
+	b := newTestBus(t, Config{Secret: "s3cret"})
+	intruder := newTestBus(t, Config{Secret: "guess"})
+	open := newTestBus(t, Config{})
+	received := subscribe(b)
+
+	a.AddPeer(b.Addr().String())
+	intruder.AddPeer(b.Addr().String())
+	open.AddPeer(b.Addr().String())
+	intruder.Publish(adapter.Message{Type: adapter.BROADCAST, Node: "intruder"})
+	open.Publish(adapter.Message{Type: adapter.BROADCAST, Node: "open"})
+	a.Publish(adapter.Message{Type: adapter.BROADCAST, Node: "a"})
+
+	expectMessage(t, received, "a")
+	expectNoMessage(t, received)
+}
+
+func TestRawConnectionRejected(t *testing.T) {
+	b := newTestBus(t, Config{Secret: "s3cret"})
+	received := subscribe(b)
+
+	conn, err := net.Dial("tcp", b.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("{\"node\":\"x\",\"nonce\":\"1\"}\n{\"node\":\"x\"}\n{\"type\":3,\"uid\":\"x\",\"nsp\":\"/\"}\n"))
+	expectNoMessage(t, received)
+}
+
+func TestSelfRemovedFromPeers(t *testing.T) {
+	a := newTestBus(t, Config{})
+	b := newTestBus(t, Config{})
+	received := subscribe(b)
+	a.setPeers([]string{a.Addr().String(), b.Addr().String()})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		a.mu.RLock()
+		_, listed := a.peers[a.Addr().String()]
+		a.mu.RUnlock()
+		if !listed {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("own address still in the peers")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	a.setPeers([]string{a.Addr().String(), b.Addr().String()})
+	a.mu.RLock()
+	_, listed := a.peers[a.Addr().String()]
+	a.mu.RUnlock()
+	if listed {
+		t.Fatal("setPeers added the own address back")
+	}
+	a.Publish(adapter.Message{Type: adapter.BROADCAST, Node: "a"})
+	expectMessage(t, received, "a")
+}
+
+func TestDropped(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	unreachable := listener.Addr().String()
+	listener.Close()
+
+	b := newTestBus(t, Config{QueueSize: 1})
+	b.AddPeer(unreachable)
+	for i := 0; i < 3; i++ {
+		b.Publish(adapter.Message{Type: adapter.BROADCAST})
+	}
+	if dropped := b.Dropped(); dropped != 2 {
+		t.Fatalf("Dropped() = %d, want 2", dropped)
+	}
+}
+
+func TestQueuedUntilPeerListens(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	a := newTestBus(t, Config{})
+	a.AddPeer(addr)
+	a.Publish(adapter.Message{Type: adapter.BROADCAST, Node: "a"})
+	time.Sleep(100 * time.Millisecond)
+
+	b, err := New(Config{Addr: addr})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	expectMessage(t, subscribe(b), "a")
+}
+
+func TestWriteTimeout(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	// The peer completes the handshake, then never reads.
+	stalled := &Bus{id: "stalled"}
+	accepted := make(chan net.Conn, 4)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() { conn.Close() })
+			if stalled.acceptHandshake(conn, bufio.NewScanner(conn)) {
+				accepted <- conn
+			}
+		}
+	}()
+
+	a := newTestBus(t, Config{Peers: []string{ln.Addr().String()}, WriteTimeout: 200 * time.Millisecond})
+	select {
+	case <-accepted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("peer not dialed")
+	}
+	data, _ := json.Marshal(strings.Repeat("x", 1<<20))
+	for i := 0; i < 64; i++ {
+		a.Publish(adapter.Message{Type: adapter.BROADCAST, Node: "a", Data: data})
+	}
+	select {
+	case <-accepted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("blocked write not timed out")
+	}
+}
+
+func TestTLS(t *testing.T) {
+	config := testTLSConfig(t)
+	a := newTestBus(t, Config{TLSConfig: config})
+	b := newTestBus(t, Config{TLSConfig: config})
+	plain := newTestBus(t, Config{})
+	received := subscribe(b)
+
+	plain.AddPeer(b.Addr().String())
+	plain.Publish(adapter.Message{Type: adapter.BROADCAST, Node: "plain"})
+	a.AddPeer(b.Addr().String())
+	a.Publish(adapter.Message{Type: adapter.BROADCAST, Node: "a"})
+
+	expectMessage(t, received, "a")
+	expectNoMessage(t, received)
+}
+
+// testTLSConfig returns a config trusting its own self-signed certificate
+// for 127.0.0.1.
+func testTLSConfig(t *testing.T) *tls.Config {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "socketio-test"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+		RootCAs:      pool,
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+}
@@ -0,0 +1,71 @@
+package socketio
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+const defaultAuthTimeout = 10 * time.Second
+
+var ErrorAuthTimeout = errors.New("authentication timeout")
+
+// AuthenticateFunc validates the CONNECT payload of a namespace. The returned
+// principal is stored on the socket; a non-nil error rejects the connection
+// with a CONNECT_ERROR. Return a *UseError to send custom data to the client.
+type AuthenticateFunc func(ctx context.Context, socket *Socket, auth map[string]interface{}) (principal interface{}, err error)
+
+func (nps *Namespace) OnAuthenticate(fn AuthenticateFunc) {
+	nps.authenticateFn = fn
+}
+
+// SetAuthTimeout bounds how long OnAuthenticate may run, 10 seconds by default.
+func (nps *Namespace) SetAuthTimeout(timeout time.Duration) {
+	nps.authTimeout = timeout
+}
+
+func (nps *Namespace) authenticate(fn AuthenticateFunc, socket *Socket, auth map[string]interface{}) (interface{}, error) {
+	timeout := nps.authTimeout
+	if timeout <= 0 {
+		timeout = defaultAuthTimeout
+	}
+	ctx, cancel := context.WithTimeout(socket.Context(), timeout)
+	defer cancel()
+
+	type result struct {
+		principal interface{}
+		err       error
+	}
+	done := make(chan result, 1)
+	go func() {
+		principal, err := fn(ctx, socket, auth)
+		done <- result{principal, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.principal, r.err
+	case <-ctx.Done():
+		return nil, ErrorAuthTimeout
+	}
+}
+
+func connectErrorData(err error) map[string]interface{} {
+	var useError *UseError
+	if errors.As(err, &useError) {
+		return map[string]interface{}{
+			"message": useError.Message,
+			"data":    useError.Data,
+		}
+	}
+	var useErrorValue UseError
+	if errors.As(err, &useErrorValue) {
+		return map[string]interface{}{
+			"message": useErrorValue.Message,
+			"data":    useErrorValue.Data,
+		}
+	}
+	return map[string]interface{}{
+		"message": err.Error(),
+	}
+}
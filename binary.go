@@ -0,0 +1,74 @@
+package socketio
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/doquangtan/socketio/v4/engineio"
+	"github.com/doquangtan/socketio/v4/protocol"
+)
+
+// binaryPacket is a BINARY_EVENT received without its attachments yet; they
+// arrive as the next binary messages of the connection.
+type binaryPacket struct {
+	socket      *Socket
+	data        string
+	ackId       string
+	expected    int
+	attachments [][]byte
+}
+
+// handleBinaryEvent parses "5<count>-[<namespace>,][<ackId>]<payload>".
+func (s *Io) handleBinaryEvent(socket *Socket, message string) error {
+	count, rest, ok := strings.Cut(message[1:], "-")
+	expected, err := strconv.Atoi(count)
+	if !ok || err != nil || expected < 0 {
+		return nil
+	}
+	_, namespace, ackId, rawpayload := splitPacket(engineio.MESSAGE.String() + protocol.EVENT.String() + rest)
+	socket_nps, err := s.namespaceSocket(namespace, socket.Id)
+	if err != nil {
+		return err
+	}
+	c := socket.conn()
+	if c == nil {
+		return nil
+	}
+	c.binary = &binaryPacket{
+		socket:   socket_nps,
+		data:     rawpayload,
+		ackId:    ackId,
+		expected: expected,
+	}
+	if expected == 0 {
+		s.completeBinary(c)
+	}
+	return nil
+}
+
+// handleBinary adds an attachment to the pending binary packet.
+func (s *Io) handleBinary(socket *Socket, data []byte) {
+	c := socket.conn()
+	if c == nil || c.binary == nil {
+		return
+	}
+	c.binary.attachments = append(c.binary.attachments, data)
+	if len(c.binary.attachments) >= c.binary.expected {
+		s.completeBinary(c)
+	}
+}
+
+func (s *Io) completeBinary(c *Conn) {
+	p := c.binary
+	c.binary = nil
+	dataJson := []interface{}{}
+	if json.Unmarshal([]byte(p.data), &dataJson) != nil {
+		return
+	}
+	s.dispatch(payload{
+		socket: p.socket,
+		data:   protocol.Reconstruct(dataJson, p.attachments),
+		ackId:  p.ackId,
+	})
+}
@@ -0,0 +1,233 @@
+package socketio
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/doquangtan/socketio/v4/adapter"
+	"github.com/doquangtan/socketio/v4/protocol"
+)
+
+// encodedPackets caches the serialized form of one broadcast packet per
+// namespace prefix, so fan-out to many sockets only encodes it once.
+type encodedPackets struct {
+	t           protocol.PacketType
+	arg         []interface{}
+	list        map[string][]byte
+	attachments [][]byte
+}
+
+func newEncodedPackets(t protocol.PacketType, arg ...interface{}) *encodedPackets {
+	return &encodedPackets{
+		t:    t,
+		arg:  arg,
+		list: make(map[string][]byte),
+	}
+}
+
+func (p *encodedPackets) get(nps string) ([]byte, [][]byte, error) {
+	if data, ok := p.list[nps]; ok {
+		return data, p.attachments, nil
+	}
+	prefix := ""
+	if nps != "/" {
+		prefix = nps + ","
+	}
+	data, attachments, err := protocol.EncodePacket(p.t, prefix, "", p.arg...)
+	if err != nil {
+		return nil, nil, err
+	}
+	p.list[nps] = data
+	p.attachments = attachments
+	return data, attachments, nil
+}
+
+func broadcastEmit(sockets []*Socket, flags adapter.BroadcastFlags, event string, agrs ...interface{}) error {
+	if len(sockets) == 0 {
+		return nil
+	}
+	packets := newEncodedPackets(protocol.EVENT, append([]interface{}{event}, agrs...))
+	for _, socket := range sockets {
+		data, attachments, err := packets.get(socket.Nps)
+		if err != nil {
+			return err
+		}
+		socket.send(outboundPacket{
+			data:         data,
+			attachments:  attachments,
+			volatile:     flags.Volatile,
+			uncompressed: flags.Uncompressed,
+		})
+	}
+	return nil
+}
+
+func (nps *Namespace) operator(opts adapter.BroadcastOptions) *broadcastOperator {
+	return &broadcastOperator{
+		nps:  nps,
+		opts: opts,
+	}
+}
+
+// Except leaves the sockets with these ids or in these rooms out.
+func (c *broadcastOperator) Except(rooms ...string) *broadcastOperator {
+	c.opts.Except = append(append([]string{}, c.opts.Except...), rooms...)
+	return c
+}
+
+// targets returns the local sockets of the operator.
+func (c *broadcastOperator) targets() []*Socket {
+	if c.nps != nil {
+		return c.nps.localSockets(c.opts)
+	}
+	return c.sockets.all()
+}
+
+func (c *broadcastOperator) cluster() *cluster {
+	if c.nps == nil || c.nps.io == nil {
+		return nil
+	}
+	return c.nps.io.cluster
+}
+
+func (c *broadcastOperator) Emit(event string, agrs ...interface{}) error {
+	if err := broadcastEmit(c.targets(), c.opts.Flags, event, agrs...); err != nil {
+		return err
+	}
+	if cl := c.cluster(); cl != nil {
+		return cl.publish(adapter.BROADCAST, c.nps.Name, "", adapter.BroadcastData{
+			Packet: adapter.Packet{
+				Type: int(protocol.EVENT),
+				Nsp:  c.nps.Name,
+				Data: append([]interface{}{event}, agrs...),
+			},
+			Opts: c.opts,
+		})
+	}
+	return nil
+}
+
+// SocketsJoin makes the selected sockets join the rooms.
+func (c *broadcastOperator) SocketsJoin(rooms ...string) {
+	socketsJoin(c.targets(), rooms)
+	if cl := c.cluster(); cl != nil {
+		cl.publish(adapter.SOCKETS_JOIN, c.nps.Name, "", adapter.SocketsJoinData{Opts: c.opts, Rooms: rooms})
+	}
+}
+
+// SocketsLeave makes the selected sockets leave the rooms.
+func (c *broadcastOperator) SocketsLeave(rooms ...string) {
+	socketsLeave(c.targets(), rooms)
+	if cl := c.cluster(); cl != nil {
+		cl.publish(adapter.SOCKETS_LEAVE, c.nps.Name, "", adapter.SocketsJoinData{Opts: c.opts, Rooms: rooms})
+	}
+}
+
+// DisconnectSockets disconnects the selected sockets.
+func (c *broadcastOperator) DisconnectSockets() {
+	disconnectSockets(c.targets())
+	if cl := c.cluster(); cl != nil {
+		cl.publish(adapter.DISCONNECT_SOCKETS, c.nps.Name, "", adapter.DisconnectSocketsData{Opts: c.opts})
+	}
+}
+
+// FetchSockets returns a snapshot of the selected sockets. The other nodes
+// are given 5 seconds to answer; use FetchSocketsContext to choose.
+func (c *broadcastOperator) FetchSockets() []RemoteSocket {
+	ret, _ := c.FetchSocketsContext(context.Background())
+	return ret
+}
+
+// FetchSocketsContext returns a snapshot of the selected sockets, and
+// ErrorAckTimeout with the sockets received so far when a node does not
+// answer before ctx is done.
+func (c *broadcastOperator) FetchSocketsContext(ctx context.Context) ([]RemoteSocket, error) {
+	ret := snapshotSockets(c.targets())
+	cl := c.cluster()
+	if cl == nil {
+		return ret, nil
+	}
+	responses, err := cl.request(ctx, adapter.FETCH_SOCKETS, c.nps.Name, adapter.FetchSocketsData{Opts: c.opts})
+	for _, raw := range responses {
+		res := fetchSocketsResponse{}
+		json.Unmarshal(raw, &res)
+		ret = append(ret, res.Sockets...)
+	}
+	return ret, err
+}
+
+type fetchSocketsResponse struct {
+	Sockets []RemoteSocket `json:"sockets"`
+}
+
+// localSockets returns the sockets of this node selected by opts.
+func (nps *Namespace) localSockets(opts adapter.BroadcastOptions) []*Socket {
+	var selected []*Socket
+	if len(opts.Rooms) == 0 && len(opts.Users) == 0 {
+		selected = nps.sockets.all()
+	} else {
+		set := make(map[string]*Socket)
+		nps.rooms.RLock()
+		for _, name := range opts.Rooms {
+			if room, ok := nps.rooms.list[name]; ok {
+				for _, socket := range room.sockets.all() {
+					set[socket.Id] = socket
+				}
+			}
+		}
+		nps.rooms.RUnlock()
+		for _, userId := range opts.Users {
+			for _, socket := range nps.users.get(userId) {
+				set[socket.Id] = socket
+			}
+		}
+		for _, socket := range set {
+			selected = append(selected, socket)
+		}
+	}
+	if len(opts.Except) == 0 {
+		return selected
+	}
+	ret := make([]*Socket, 0, len(selected))
+	for _, socket := range selected {
+		if !socket.excluded(opts.Except) {
+			ret = append(ret, socket)
+		}
+	}
+	return ret
+}
+
+func (s *Socket) excluded(except []string) bool {
+	for _, name := range except {
+		if name == s.Id || s.rooms.has(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func socketsJoin(sockets []*Socket, rooms []string) {
+	for _, socket := range sockets {
+		for _, room := range rooms {
+			if socket.Join != nil {
+				socket.Join(room)
+			}
+		}
+	}
+}
+
+func socketsLeave(sockets []*Socket, rooms []string) {
+	for _, socket := range sockets {
+		for _, room := range rooms {
+			if socket.Leave != nil {
+				socket.Leave(room)
+			}
+		}
+	}
+}
+
+func disconnectSockets(sockets []*Socket) {
+	for _, socket := range sockets {
+		socket.Disconnect()
+	}
+}
@@ -0,0 +1,129 @@
+package socketio
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/doquangtan/socketio/v4/adapter"
+	"github.com/doquangtan/socketio/v4/protocol"
+)
+
+// queuedSockets returns sockets whose queue keeps their last packet, without
+// a session to write it to.
+func queuedSockets(n int, nps string) []*Socket {
+	sockets := make([]*Socket, n)
+	for i := range sockets {
+		sockets[i] = &Socket{
+			Id:   fmt.Sprintf("socket-%d", i),
+			Nps:  nps,
+			Conn: &Conn{queue: newSendQueue(1, DropOldest)},
+			listeners: listeners{
+				list: make(map[string][]eventCallback),
+			},
+		}
+	}
+	return sockets
+}
+
+func queued(t testing.TB, socket *Socket) outboundPacket {
+	t.Helper()
+	socket.Conn.queue.Lock()
+	defer socket.Conn.queue.Unlock()
+	if len(socket.Conn.queue.list) != 1 {
+		t.Fatalf("%d packets queued for %s", len(socket.Conn.queue.list), socket.Id)
+	}
+	return socket.Conn.queue.list[0]
+}
+
+func TestBroadcastEncodesOnce(t *testing.T) {
+	sockets := append(queuedSockets(3, "/"), queuedSockets(2, "/admin")...)
+	if err := broadcastEmit(sockets, adapter.BroadcastFlags{Volatile: true}, "tick", 1, "a"); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"/":      `42["tick",1,"a"]`,
+		"/admin": `42/admin,["tick",1,"a"]`,
+	}
+	shared := map[string][]byte{}
+	for _, socket := range sockets {
+		p := queued(t, socket)
+		if got := string(bytes.TrimSuffix(p.data, []byte("\n"))); got != want[socket.Nps] {
+			t.Errorf("%s %s: packet %q, want %q", socket.Nps, socket.Id, got, want[socket.Nps])
+		}
+		if !p.volatile {
+			t.Errorf("%s: flags not kept", socket.Id)
+		}
+		// Sockets of a namespace share the bytes of one encoding.
+		if data, ok := shared[socket.Nps]; ok && &data[0] != &p.data[0] {
+			t.Errorf("%s: packet encoded again", socket.Id)
+		}
+		shared[socket.Nps] = p.data
+	}
+}
+
+func TestBroadcastSharesAttachments(t *testing.T) {
+	sockets := queuedSockets(2, "/")
+	if err := broadcastEmit(sockets, adapter.BroadcastFlags{}, "file", []byte{1, 2, 3}); err != nil {
+		t.Fatal(err)
+	}
+	for _, socket := range sockets {
+		p := queued(t, socket)
+		if len(p.attachments) != 1 || !bytes.Equal(p.attachments[0], []byte{1, 2, 3}) {
+			t.Errorf("%s: attachments %v", socket.Id, p.attachments)
+		}
+		if !bytes.HasPrefix(p.data, []byte(`451-["file",{"_placeholder":true,"num":0}]`)) {
+			t.Errorf("%s: packet %q", socket.Id, p.data)
+		}
+	}
+}
+
+var tick = map[string]interface{}{
+	"symbol": "ACME",
+	"price":  128.25,
+	"volume": 1200,
+	"bids":   []float64{128.2, 128.1, 128},
+	"asks":   []float64{128.3, 128.4, 128.5},
+}
+
+// BenchmarkBroadcast fans a ticker event out to a room, encoding it for every
+// socket as Socket.Emit does, and once for all of them as Room.Emit does.
+func BenchmarkBroadcast(b *testing.B) {
+	for _, n := range []int{100, 1000, 20000} {
+		sockets := queuedSockets(n, "/")
+		b.Run(fmt.Sprintf("%d/per-socket", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				for _, socket := range sockets {
+					if err := socket.writer(protocol.EVENT, "tick", tick); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("%d/encode-once", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if err := broadcastEmit(sockets, adapter.BroadcastFlags{}, "tick", tick); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestBroadcastAllocations(t *testing.T) {
+	sockets := queuedSockets(100, "/")
+	perSocket := testing.AllocsPerRun(10, func() {
+		for _, socket := range sockets {
+			socket.writer(protocol.EVENT, "tick", tick)
+		}
+	})
+	once := testing.AllocsPerRun(10, func() {
+		broadcastEmit(sockets, adapter.BroadcastFlags{}, "tick", tick)
+	})
+	// Encoding dominates: sharing it must save most allocations.
+	if once*4 > perSocket {
+		t.Errorf("%v allocations encoding once, %v per socket", once, perSocket)
+	}
+}
@@ -0,0 +1,344 @@
+package socketio
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/doquangtan/socketio/v4/adapter"
+)
+
+const (
+	heartbeatInterval = 5 * time.Second
+	heartbeatTimeout  = 10 * time.Second
+	defaultAckTimeout = 5 * time.Second
+)
+
+var ErrorAckTimeout = errors.New("operation has timed out")
+
+type clusterRequest struct {
+	sync.Mutex
+	expected  int
+	responses map[string]json.RawMessage
+	done      chan struct{}
+}
+
+func (r *clusterRequest) add(node string, data json.RawMessage) {
+	r.Lock()
+	defer r.Unlock()
+	if _, ok := r.responses[node]; ok || len(r.responses) >= r.expected {
+		return
+	}
+	r.responses[node] = data
+	if len(r.responses) == r.expected {
+		close(r.done)
+	}
+}
+
+func (r *clusterRequest) all() []json.RawMessage {
+	r.Lock()
+	defer r.Unlock()
+	ret := make([]json.RawMessage, 0, len(r.responses))
+	for _, data := range r.responses {
+		ret = append(ret, data)
+	}
+	return ret
+}
+
+// cluster connects the Io to the other nodes through the adapter bus. Nodes
+// announce themselves with heartbeats so that requests know how many
+// responses to wait for.
+type cluster struct {
+	sync.RWMutex
+	io       *Io
+	bus      adapter.Bus
+	uid      string
+	nodes    map[string]time.Time
+	requests map[string]*clusterRequest
+}
+
+func newCluster(io *Io, bus adapter.Bus) *cluster {
+	return &cluster{
+		io:       io,
+		bus:      bus,
+		uid:      io.randomUUID(),
+		nodes:    make(map[string]time.Time),
+		requests: make(map[string]*clusterRequest),
+	}
+}
+
+func (c *cluster) start(ctx context.Context) {
+	c.bus.Subscribe(c.onMessage)
+	c.publish(adapter.INITIAL_HEARTBEAT, "/", "", nil)
+	go func() {
+		ticker := time.NewTicker(heartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				c.publish(adapter.HEARTBEAT, "/", "", nil)
+				c.pruneNodes()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+func (c *cluster) close() {
+	c.publish(adapter.ADAPTER_CLOSE, "/", "", nil)
+	c.bus.Close()
+}
+
+func (c *cluster) publish(t adapter.MessageType, nsp string, requestId string, data interface{}) error {
+	msg := adapter.Message{
+		Type:      t,
+		Node:      c.uid,
+		Nsp:       nsp,
+		RequestID: requestId,
+	}
+	if data != nil {
+		raw, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		msg.Data = raw
+	}
+	return c.bus.Publish(msg)
+}
+
+func (c *cluster) pruneNodes() {
+	c.Lock()
+	defer c.Unlock()
+	for node, lastSeen := range c.nodes {
+		if time.Since(lastSeen) > heartbeatTimeout {
+			delete(c.nodes, node)
+		}
+	}
+}
+
+func (c *cluster) serverCount() int {
+	c.RLock()
+	defer c.RUnlock()
+	return len(c.nodes) + 1
+}
+
+// request publishes a message to every other node and collects one response
+// per node until all answered or ctx is done.
+func (c *cluster) request(ctx context.Context, t adapter.MessageType, nsp string, data interface{}) ([]json.RawMessage, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, defaultAckTimeout)
+		defer cancel()
+	}
+	expected := c.serverCount() - 1
+	if expected == 0 {
+		return []json.RawMessage{}, nil
+	}
+	requestId := c.io.randomUUID()
+	req := &clusterRequest{
+		expected:  expected,
+		responses: make(map[string]json.RawMessage),
+		done:      make(chan struct{}),
+	}
+	c.Lock()
+	c.requests[requestId] = req
+	c.Unlock()
+	defer func() {
+		c.Lock()
+		delete(c.requests, requestId)
+		c.Unlock()
+	}()
+
+	if err := c.publish(t, nsp, requestId, data); err != nil {
+		return nil, err
+	}
+	select {
+	case <-req.done:
+		return req.all(), nil
+	case <-ctx.Done():
+		return req.all(), ErrorAckTimeout
+	}
+}
+
+func (c *cluster) onMessage(msg adapter.Message) {
+	if msg.Node == c.uid {
+		return
+	}
+	switch msg.Type {
+	case adapter.INITIAL_HEARTBEAT:
+		c.seen(msg.Node)
+		c.publish(adapter.HEARTBEAT, "/", "", nil)
+	case adapter.HEARTBEAT:
+		c.seen(msg.Node)
+	case adapter.ADAPTER_CLOSE:
+		c.Lock()
+		delete(c.nodes, msg.Node)
+		c.Unlock()
+	case adapter.SERVER_SIDE_EMIT:
+		if nps := c.io.namespaces.get(msg.Nsp); nps != nil {
+			// Handlers run apart from the bus, which must keep delivering
+			// the responses of the requests they make.
+			go nps.onServerSideEmit(msg)
+		}
+	case adapter.BROADCAST, adapter.SOCKETS_JOIN, adapter.SOCKETS_LEAVE, adapter.DISCONNECT_SOCKETS:
+		if nps := c.io.namespaces.get(msg.Nsp); nps != nil {
+			nps.onClusterOperation(msg)
+		}
+	case adapter.FETCH_SOCKETS, adapter.FETCH_PRESENCE:
+		// Answered apart, so that the bus keeps delivering while the local
+		// sockets are read.
+		go c.answer(msg)
+	case adapter.SERVER_SIDE_EMIT_RESPONSE, adapter.FETCH_SOCKETS_RESPONSE, adapter.FETCH_PRESENCE_RESPONSE:
+		c.RLock()
+		req, ok := c.requests[msg.RequestID]
+		c.RUnlock()
+		if ok {
+			req.add(msg.Node, msg.Data)
+		}
+	}
+}
+
+func (c *cluster) answer(msg adapter.Message) {
+	switch msg.Type {
+	case adapter.FETCH_SOCKETS:
+		res := fetchSocketsResponse{Sockets: []RemoteSocket{}}
+		if nps := c.io.namespaces.get(msg.Nsp); nps != nil {
+			data := adapter.FetchSocketsData{}
+			json.Unmarshal(msg.Data, &data)
+			res.Sockets = snapshotSockets(nps.localSockets(data.Opts))
+		}
+		c.publish(adapter.FETCH_SOCKETS_RESPONSE, msg.Nsp, msg.RequestID, res)
+	case adapter.FETCH_PRESENCE:
+		res := fetchPresenceResponse{Members: []PresenceMember{}}
+		if nps := c.io.namespaces.get(msg.Nsp); nps != nil {
+			data := adapter.FetchPresenceData{}
+			json.Unmarshal(msg.Data, &data)
+			res.Members = nps.PresenceList(data.Room)
+		}
+		c.publish(adapter.FETCH_PRESENCE_RESPONSE, msg.Nsp, msg.RequestID, res)
+	}
+}
+
+func (c *cluster) seen(node string) {
+	c.Lock()
+	c.nodes[node] = time.Now()
+	c.Unlock()
+}
+
+// onClusterOperation applies an operation of another node to the local
+// sockets, without publishing it again.
+func (nps *Namespace) onClusterOperation(msg adapter.Message) {
+	switch msg.Type {
+	case adapter.BROADCAST:
+		data := adapter.BroadcastData{}
+		if json.Unmarshal(msg.Data, &data) != nil || len(data.Packet.Data) == 0 {
+			return
+		}
+		event, ok := data.Packet.Data[0].(string)
+		if !ok {
+			return
+		}
+		broadcastEmit(nps.localSockets(data.Opts), data.Opts.Flags, event, data.Packet.Data[1:]...)
+	case adapter.SOCKETS_JOIN, adapter.SOCKETS_LEAVE:
+		data := adapter.SocketsJoinData{}
+		if json.Unmarshal(msg.Data, &data) != nil {
+			return
+		}
+		if msg.Type == adapter.SOCKETS_JOIN {
+			socketsJoin(nps.localSockets(data.Opts), data.Rooms)
+		} else {
+			socketsLeave(nps.localSockets(data.Opts), data.Rooms)
+		}
+	case adapter.DISCONNECT_SOCKETS:
+		data := adapter.DisconnectSocketsData{}
+		if json.Unmarshal(msg.Data, &data) != nil {
+			return
+		}
+		disconnectSockets(nps.localSockets(data.Opts))
+	}
+}
+
+// OnServerSide registers a handler of the events other nodes send with
+// ServerSideEmit. Event.Ack answers ServerSideEmitWithAck. Handlers run on
+// goroutines of their own, possibly concurrently, and may make cluster
+// requests such as FetchSockets.
+func (nps *Namespace) OnServerSide(event string, fn eventCallback) {
+	nps.serverSide.set(event, fn)
+}
+
+// ServerSideEmit sends an event to the OnServerSide handlers of every other
+// node of the cluster. It does nothing without an adapter.
+func (nps *Namespace) ServerSideEmit(event string, agrs ...interface{}) error {
+	if nps.io == nil || nps.io.cluster == nil {
+		return nil
+	}
+	return nps.io.cluster.publish(adapter.SERVER_SIDE_EMIT, nps.Name, "", append([]interface{}{event}, agrs...))
+}
+
+// ServerSideEmitWithAck is ServerSideEmit waiting for the acknowledgement of
+// every other node. It returns the ack arguments of each node, and
+// ErrorAckTimeout with the responses received so far when ctx expires first
+// (5 seconds when ctx has no deadline).
+func (nps *Namespace) ServerSideEmitWithAck(ctx context.Context, event string, agrs ...interface{}) ([][]interface{}, error) {
+	if nps.io == nil || nps.io.cluster == nil {
+		return [][]interface{}{}, nil
+	}
+	responses, err := nps.io.cluster.request(ctx, adapter.SERVER_SIDE_EMIT, nps.Name, append([]interface{}{event}, agrs...))
+	ret := make([][]interface{}, 0, len(responses))
+	for _, raw := range responses {
+		data := []interface{}{}
+		json.Unmarshal(raw, &data)
+		ret = append(ret, data)
+	}
+	return ret, err
+}
+
+func (nps *Namespace) onServerSideEmit(msg adapter.Message) {
+	dataJson := []interface{}{}
+	json.Unmarshal(msg.Data, &dataJson)
+	if len(dataJson) == 0 {
+		return
+	}
+	event, ok := dataJson[0].(string)
+	if !ok {
+		return
+	}
+	for _, callback := range nps.serverSide.get(event) {
+		var ack AckCallback
+		if msg.RequestID != "" {
+			ack = func(data ...interface{}) {
+				nps.io.cluster.publish(adapter.SERVER_SIDE_EMIT_RESPONSE, nps.Name, msg.RequestID, data)
+			}
+		}
+		callback(&EventPayload{
+			Name:  event,
+			SID:   msg.Node,
+			Error: nil,
+			Data:  append([]interface{}{}, dataJson[1:]...),
+			Ack:   ack,
+		})
+	}
+}
+
+// ServerCount returns the number of nodes of the cluster, this one included.
+func (a *Adapter) ServerCount() int {
+	if a.nps.io == nil || a.nps.io.cluster == nil {
+		return 1
+	}
+	return a.nps.io.cluster.serverCount()
+}
+
+func (s *Io) OnServerSide(event string, fn eventCallback) {
+	s.Of("/").OnServerSide(event, fn)
+}
+
+func (s *Io) ServerSideEmit(event string, agrs ...interface{}) error {
+	return s.Of("/").ServerSideEmit(event, agrs...)
+}
+
+func (s *Io) ServerSideEmitWithAck(ctx context.Context, event string, agrs ...interface{}) ([][]interface{}, error) {
+	return s.Of("/").ServerSideEmitWithAck(ctx, event, agrs...)
+}
@@ -0,0 +1,190 @@
+package socketio
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/doquangtan/socketio/v4/adapter"
+)
+
+// newTestCluster starts n nodes on one MemoryHub and waits until they know
+// each other.
+func newTestCluster(t *testing.T, n int) []*Io {
+	hub := adapter.NewMemoryHub()
+	nodes := make([]*Io, n)
+	for i := range nodes {
+		nodes[i] = New(WithAdapter(hub.Bus()))
+	}
+	t.Cleanup(func() {
+		for _, node := range nodes {
+			node.Close()
+		}
+	})
+	waitServerCount(t, nodes, n)
+	return nodes
+}
+
+func waitServerCount(t *testing.T, nodes []*Io, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for _, node := range nodes {
+		for node.Of("/").Adapter().ServerCount() != n {
+			if time.Now().After(deadline) {
+				t.Fatalf("ServerCount = %d, want %d", node.Of("/").Adapter().ServerCount(), n)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
+
+func TestServerSideEmit(t *testing.T) {
+	nodes := newTestCluster(t, 3)
+	received := make(chan int, 8)
+	for i, node := range nodes {
+		i := i
+		node.OnServerSide("invalidate", func(e *EventPayload) {
+			if len(e.Data) != 1 || e.Data[0] != "user:1" || e.Ack != nil {
+				t.Errorf("node %d received %+v", i, e)
+			}
+			received <- i
+		})
+	}
+	if err := nodes[0].ServerSideEmit("invalidate", "user:1"); err != nil {
+		t.Fatal(err)
+	}
+	got := []int{}
+	for len(got) < 2 {
+		select {
+		case i := <-received:
+			got = append(got, i)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("received by nodes %v only", got)
+		}
+	}
+	sort.Ints(got)
+	if got[0] != 1 || got[1] != 2 {
+		t.Errorf("received by nodes %v, want the other nodes 1 and 2", got)
+	}
+	select {
+	case i := <-received:
+		t.Errorf("received again by node %d", i)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestServerSideEmitNamespace(t *testing.T) {
+	nodes := newTestCluster(t, 2)
+	received := make(chan string, 2)
+	nodes[1].OnServerSide("job", func(e *EventPayload) { received <- "/" })
+	nodes[1].Of("/admin").OnServerSide("job", func(e *EventPayload) { received <- "/admin" })
+	nodes[0].Of("/admin").ServerSideEmit("job")
+	select {
+	case nsp := <-received:
+		if nsp != "/admin" {
+			t.Errorf("delivered to %s", nsp)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("not delivered")
+	}
+}
+
+func TestServerSideEmitWithAck(t *testing.T) {
+	nodes := newTestCluster(t, 3)
+	for i, node := range nodes {
+		i := i
+		node.OnServerSide("count", func(e *EventPayload) {
+			e.Ack(i * 10)
+		})
+	}
+	responses, err := nodes[0].ServerSideEmitWithAck(context.Background(), "count")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []float64{}
+	for _, res := range responses {
+		if len(res) != 1 {
+			t.Fatalf("response %v", res)
+		}
+		got = append(got, res[0].(float64))
+	}
+	sort.Float64s(got)
+	if len(got) != 2 || got[0] != 10 || got[1] != 20 {
+		t.Errorf("responses %v, want 10 and 20", got)
+	}
+}
+
+func TestServerSideEmitWithAckTimeout(t *testing.T) {
+	nodes := newTestCluster(t, 3)
+	nodes[1].OnServerSide("count", func(e *EventPayload) { e.Ack(1) })
+	// nodes[2] never acknowledges.
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	responses, err := nodes[0].ServerSideEmitWithAck(ctx, "count")
+	if err != ErrorAckTimeout {
+		t.Fatalf("error = %v, want ErrorAckTimeout", err)
+	}
+	if len(responses) != 1 {
+		t.Errorf("responses %v, want the one of node 1", responses)
+	}
+}
+
+func TestServerSideEmitWithoutAdapter(t *testing.T) {
+	io := New()
+	t.Cleanup(io.Close)
+	if err := io.ServerSideEmit("x"); err != nil {
+		t.Fatal(err)
+	}
+	responses, err := io.ServerSideEmitWithAck(context.Background(), "x")
+	if err != nil || len(responses) != 0 {
+		t.Fatalf("ServerSideEmitWithAck = %v, %v", responses, err)
+	}
+	if n := io.Of("/").Adapter().ServerCount(); n != 1 {
+		t.Errorf("ServerCount = %d, want 1", n)
+	}
+}
+
+func TestServerCountAfterClose(t *testing.T) {
+	hub := adapter.NewMemoryHub()
+	nodes := []*Io{New(WithAdapter(hub.Bus())), New(WithAdapter(hub.Bus()))}
+	t.Cleanup(func() {
+		nodes[0].Close()
+		nodes[1].Close()
+	})
+	leaving := New(WithAdapter(hub.Bus()))
+	waitServerCount(t, append(nodes, leaving), 3)
+	leaving.Close()
+	waitServerCount(t, nodes, 2)
+}
+
+func TestServerSideHandlerMakesClusterRequest(t *testing.T) {
+	nodes := newTestCluster(t, 3)
+	for i, node := range nodes {
+		i := i
+		node.OnServerSide("count", func(e *EventPayload) { e.Ack(i) })
+	}
+	done := make(chan error, 1)
+	nodes[1].OnServerSide("collect", func(e *EventPayload) {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		responses, err := nodes[1].ServerSideEmitWithAck(ctx, "count")
+		if err == nil && len(responses) != 2 {
+			err = fmt.Errorf("responses %v, want 2", responses)
+		}
+		if err == nil {
+			_, err = nodes[1].Of("/").FetchSocketsContext(ctx)
+		}
+		done <- err
+	})
+	nodes[0].ServerSideEmit("collect")
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("nested request did not complete")
+	}
+}
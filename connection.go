@@ -17,11 +17,11 @@ type connections struct {
 
 func (l *connections) set(socket *Socket) error {
 	l.Lock()
+	defer l.Unlock()
 	if l.conn[socket.Id] != nil {
 		return ErrorUUIDDuplication
 	}
 	l.conn[socket.Id] = socket
-	l.Unlock()
 	return nil
 }
 
@@ -0,0 +1,104 @@
+package socketio
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/doquangtan/socketio/v4/engineio"
+)
+
+// SocketData holds arbitrary values attached to a socket, e.g. by a
+// middleware. It is safe for concurrent use and serializes to a JSON object.
+type SocketData struct {
+	sync.RWMutex
+	values map[string]interface{}
+}
+
+func newSocketData() *SocketData {
+	return &SocketData{
+		values: make(map[string]interface{}),
+	}
+}
+
+func (d *SocketData) Set(key string, value interface{}) {
+	d.Lock()
+	d.values[key] = value
+	d.Unlock()
+}
+
+func (d *SocketData) Get(key string) (interface{}, bool) {
+	d.RLock()
+	defer d.RUnlock()
+	value, ok := d.values[key]
+	return value, ok
+}
+
+func (d *SocketData) Delete(key string) {
+	d.Lock()
+	delete(d.values, key)
+	d.Unlock()
+}
+
+// All returns a shallow copy of every value.
+func (d *SocketData) All() map[string]interface{} {
+	d.RLock()
+	defer d.RUnlock()
+	ret := make(map[string]interface{}, len(d.values))
+	for key, value := range d.values {
+		ret[key] = value
+	}
+	return ret
+}
+
+func (d *SocketData) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.All())
+}
+
+func (d *SocketData) UnmarshalJSON(data []byte) error {
+	values := make(map[string]interface{})
+	if err := json.Unmarshal(data, &values); err != nil {
+		return err
+	}
+	d.Lock()
+	d.values = values
+	d.Unlock()
+	return nil
+}
+
+// GetData returns the value stored under key when it has type T.
+func GetData[T any](socket *Socket, key string) (T, bool) {
+	value, ok := socket.Data.Get(key)
+	if !ok {
+		var zero T
+		return zero, false
+	}
+	ret, ok := value.(T)
+	return ret, ok
+}
+
+// RemoteSocket is a snapshot of a socket, as returned by FetchSockets.
+type RemoteSocket struct {
+	Id        string                 `json:"id"`
+	Nps       string                 `json:"nsp"`
+	Handshake engineio.Handshake     `json:"handshake"`
+	Rooms     []string               `json:"rooms"`
+	Data      map[string]interface{} `json:"data"`
+}
+
+func (s *Socket) snapshot() RemoteSocket {
+	return RemoteSocket{
+		Id:        s.Id,
+		Nps:       s.Nps,
+		Handshake: s.handshake(),
+		Rooms:     s.Rooms(),
+		Data:      s.Data.All(),
+	}
+}
+
+func snapshotSockets(sockets []*Socket) []RemoteSocket {
+	ret := make([]RemoteSocket, 0, len(sockets))
+	for _, socket := range sockets {
+		ret = append(ret, socket.snapshot())
+	}
+	return ret
+}
@@ -0,0 +1,134 @@
+package socketio
+
+import (
+	"context"
+	"encoding/json"
+	"hash/fnv"
+	"reflect"
+	"time"
+)
+
+// DispatchMode controls how incoming events are handed to their handlers.
+type DispatchMode int
+
+const (
+	// DispatchSharded runs handlers on a fixed pool of workers. Every event of
+	// a connection lands on the same worker, so per-socket order is kept.
+	DispatchSharded DispatchMode = iota
+	// DispatchPerSocket runs the handlers of each connection on a goroutine of
+	// its own, keeping per-socket order.
+	DispatchPerSocket
+	// DispatchConcurrent runs every event on a new goroutine. Handlers of one
+	// socket may run concurrently and out of order.
+	DispatchConcurrent
+)
+
+const dispatchBuffer = 64
+
+func (s *Io) startDispatch(ctx context.Context) {
+	if s.dispatchMode != DispatchSharded {
+		return
+	}
+	s.shards = make([]chan payload, s.dispatchWorkers)
+	for i := range s.shards {
+		s.shards[i] = make(chan payload, dispatchBuffer)
+		go s.read(ctx, s.shards[i], nil)
+	}
+}
+
+func (s *Io) dispatch(payLoad payload) {
+	switch s.dispatchMode {
+	case DispatchConcurrent:
+		go s.handleEvent(payLoad)
+	case DispatchPerSocket:
+		c := payLoad.socket.conn()
+		if c == nil {
+			return
+		}
+		c.inboundOnce.Do(func() {
+			c.inbound = make(chan payload, dispatchBuffer)
+			go s.read(s.ctx, c.inbound, c.queue.done)
+		})
+		select {
+		case c.inbound <- payLoad:
+		case <-c.queue.done:
+		case <-s.ctx.Done():
+		}
+	default:
+		h := fnv.New32a()
+		h.Write([]byte(payLoad.socket.Id))
+		select {
+		case s.shards[h.Sum32()%uint32(len(s.shards))] <- payLoad:
+		case <-s.ctx.Done():
+		}
+	}
+}
+
+func (s *Io) read(ctx context.Context, in <-chan payload, done <-chan struct{}) {
+	for {
+		select {
+		case payLoad := <-in:
+			s.handleEvent(payLoad)
+		case <-done:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *Io) handleEvent(payLoad payload) {
+	if payLoad.socket.conn() == nil {
+		return
+	}
+	dataJson := []interface{}{}
+	switch data := payLoad.data.(type) {
+	case string:
+		json.Unmarshal([]byte(data), &dataJson)
+	case []interface{}:
+		dataJson = data
+	}
+	if len(dataJson) == 0 || reflect.TypeOf(dataJson[0]).String() != "string" {
+		return
+	}
+	event := dataJson[0].(string)
+	timeout := time.Duration(0)
+	if payLoad.socket.currentNamespace != nil {
+		timeout = payLoad.socket.currentNamespace().handlerTimeout
+	}
+	for _, callback := range payLoad.socket.listeners.get(event) {
+		data := append([]interface{}{}, dataJson[1:]...)
+
+		ctx, cancel := payLoad.socket.Context(), context.CancelFunc(func() {})
+		if timeout > 0 {
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+		}
+
+		ackCallback := AckCallback(func(data ...interface{}) {
+			payLoad.socket.ack(payLoad.ackId, data...)
+		})
+
+		if payLoad.ackId == "" {
+			callback(&EventPayload{
+				SID:    payLoad.socket.Id,
+				Name:   event,
+				Socket: payLoad.socket,
+				Error:  nil,
+				Data:   data,
+				Ack:    nil,
+				ctx:    ctx,
+			})
+		} else {
+			callback(&EventPayload{
+				SID:    payLoad.socket.Id,
+				Name:   event,
+				Socket: payLoad.socket,
+				Error:  nil,
+				Data:   data,
+				Ack:    ackCallback,
+				ctx:    ctx,
+			})
+		}
+		cancel()
+	}
+}
@@ -0,0 +1,143 @@
+package socketio
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newDispatchIo(t testing.TB, mode DispatchMode, workers int) *Io {
+	io := New(WithDispatch(mode, workers))
+	t.Cleanup(io.Close)
+	return io
+}
+
+func TestDispatchKeepsSocketOrder(t *testing.T) {
+	for name, mode := range map[string]DispatchMode{"sharded": DispatchSharded, "per-socket": DispatchPerSocket} {
+		t.Run(name, func(t *testing.T) {
+			io := newDispatchIo(t, mode, 2)
+			sockets := queuedSockets(8, "/")
+			var mu sync.Mutex
+			var wg sync.WaitGroup
+			received := map[string][]float64{}
+			for _, socket := range sockets {
+				socket := socket
+				socket.On("n", func(e *EventPayload) {
+					mu.Lock()
+					received[socket.Id] = append(received[socket.Id], e.Data[0].(float64))
+					mu.Unlock()
+					wg.Done()
+				})
+			}
+			const events = 200
+			wg.Add(len(sockets) * events)
+			for i := 0; i < events; i++ {
+				for _, socket := range sockets {
+					io.dispatch(payload{socket: socket, data: fmt.Sprintf(`["n",%d]`, i)})
+				}
+			}
+			wg.Wait()
+			for _, socket := range sockets {
+				for i, n := range received[socket.Id] {
+					if n != float64(i) {
+						t.Fatalf("%s: event %v received at %d", socket.Id, n, i)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestDispatchSlowHandler(t *testing.T) {
+	for name, mode := range map[string]DispatchMode{"per-socket": DispatchPerSocket, "concurrent": DispatchConcurrent} {
+		t.Run(name, func(t *testing.T) {
+			io := newDispatchIo(t, mode, 0)
+			sockets := queuedSockets(2, "/")
+			release := make(chan struct{})
+			defer close(release)
+			sockets[0].On("slow", func(e *EventPayload) { <-release })
+			done := make(chan struct{})
+			sockets[1].On("fast", func(e *EventPayload) { close(done) })
+
+			io.dispatch(payload{socket: sockets[0], data: `["slow"]`})
+			io.dispatch(payload{socket: sockets[1], data: `["fast"]`})
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("a slow handler stalls the other sockets")
+			}
+		})
+	}
+}
+
+func TestDispatchShardedWorkers(t *testing.T) {
+	io := newDispatchIo(t, DispatchSharded, 4)
+	sockets := queuedSockets(64, "/")
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	active, most := 0, 0
+	for _, socket := range sockets {
+		socket.On("work", func(e *EventPayload) {
+			mu.Lock()
+			active++
+			if active > most {
+				most = active
+			}
+			mu.Unlock()
+			time.Sleep(10 * time.Millisecond)
+			mu.Lock()
+			active--
+			mu.Unlock()
+			wg.Done()
+		})
+	}
+	wg.Add(len(sockets))
+	for _, socket := range sockets {
+		io.dispatch(payload{socket: socket, data: `["work"]`})
+	}
+	wg.Wait()
+	if most < 2 || most > 4 {
+		t.Errorf("%d handlers ran at once, want up to the 4 workers", most)
+	}
+}
+
+// BenchmarkDispatch runs handlers waiting 100µs, e.g. on a database, for 256
+// sockets. Throughput grows with the workers of DispatchSharded, and with the
+// sockets for DispatchPerSocket and DispatchConcurrent; one worker is the
+// former single reader goroutine.
+func BenchmarkDispatch(b *testing.B) {
+	modes := []struct {
+		name    string
+		mode    DispatchMode
+		workers int
+	}{
+		{"sharded-1", DispatchSharded, 1},
+		{"sharded-4", DispatchSharded, 4},
+		{"sharded-16", DispatchSharded, 16},
+		{"sharded-64", DispatchSharded, 64},
+		{"per-socket", DispatchPerSocket, 0},
+		{"concurrent", DispatchConcurrent, 0},
+	}
+	for _, m := range modes {
+		b.Run(m.name, func(b *testing.B) {
+			io := newDispatchIo(b, m.mode, m.workers)
+			sockets := queuedSockets(256, "/")
+			var wg sync.WaitGroup
+			for _, socket := range sockets {
+				socket.On("work", func(e *EventPayload) {
+					time.Sleep(100 * time.Microsecond)
+					wg.Done()
+				})
+			}
+			wg.Add(b.N)
+			start := time.Now()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				io.dispatch(payload{socket: sockets[i%len(sockets)], data: `["work"]`})
+			}
+			wg.Wait()
+			b.ReportMetric(float64(b.N)/time.Since(start).Seconds(), "events/s")
+		})
+	}
+}
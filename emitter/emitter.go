@@ -0,0 +1,141 @@
+// Package emitter publishes events to the Socket.IO servers of a cluster from
+// processes that do not host one, e.g. cron jobs or HTTP workers. It only
+// needs the adapter bus the servers use.
+//
+//	e := emitter.New(bus)
+//	e.Of("/admin").To("room1").Emit("hello", "world")
+package emitter
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/doquangtan/socketio/v4/adapter"
+	"github.com/doquangtan/socketio/v4/protocol"
+)
+
+// Emitter targets a namespace, "/" unless chosen with Of.
+type Emitter struct {
+	bus  adapter.Bus
+	uid  string
+	nsp  string
+	opts adapter.BroadcastOptions
+}
+
+func New(bus adapter.Bus) *Emitter {
+	uid := make([]byte, 16)
+	rand.Read(uid)
+	return &Emitter{
+		bus: bus,
+		uid: "emitter-" + hex.EncodeToString(uid),
+		nsp: "/",
+	}
+}
+
+// Of returns an emitter of the namespace.
+func (e *Emitter) Of(nsp string) *Emitter {
+	if nsp == "" || nsp[0] != '/' {
+		nsp = "/" + nsp
+	}
+	return &Emitter{
+		bus: e.bus,
+		uid: e.uid,
+		nsp: nsp,
+	}
+}
+
+// clone copies the emitter so that To, Except and Volatile do not change
+// the one they are called on.
+func (e *Emitter) clone() *Emitter {
+	c := *e
+	c.opts.Rooms = append([]string{}, e.opts.Rooms...)
+	c.opts.Except = append([]string{}, e.opts.Except...)
+	c.opts.Users = append([]string{}, e.opts.Users...)
+	return &c
+}
+
+// To targets the sockets of the rooms.
+func (e *Emitter) To(rooms ...string) *Emitter {
+	c := e.clone()
+	c.opts.Rooms = append(c.opts.Rooms, rooms...)
+	return c
+}
+
+// Except leaves the sockets with these ids or in these rooms out.
+func (e *Emitter) Except(rooms ...string) *Emitter {
+	c := e.clone()
+	c.opts.Except = append(c.opts.Except, rooms...)
+	return c
+}
+
+// ToUser targets the sockets of the user, see Socket.SetUserID.
+func (e *Emitter) ToUser(userId string) *Emitter {
+	c := e.clone()
+	c.opts.Users = append(c.opts.Users, userId)
+	return c
+}
+
+func (e *Emitter) Volatile() *Emitter {
+	c := e.clone()
+	c.opts.Flags.Volatile = true
+	return c
+}
+
+// Compress(false) skips the permessage-deflate compression of the packets.
+func (e *Emitter) Compress(compress bool) *Emitter {
+	c := e.clone()
+	c.opts.Flags.Uncompressed = !compress
+	return c
+}
+
+func (e *Emitter) Emit(event string, agrs ...interface{}) error {
+	return e.publish(adapter.BROADCAST, adapter.BroadcastData{
+		Packet: adapter.Packet{
+			Type: int(protocol.EVENT),
+			Nsp:  e.nsp,
+			Data: append([]interface{}{event}, agrs...),
+		},
+		Opts: e.opts,
+	})
+}
+
+// SocketsJoin makes the targeted sockets join the rooms.
+func (e *Emitter) SocketsJoin(rooms ...string) error {
+	return e.publish(adapter.SOCKETS_JOIN, adapter.SocketsJoinData{
+		Opts:  e.opts,
+		Rooms: rooms,
+	})
+}
+
+func (e *Emitter) SocketsLeave(rooms ...string) error {
+	return e.publish(adapter.SOCKETS_LEAVE, adapter.SocketsJoinData{
+		Opts:  e.opts,
+		Rooms: rooms,
+	})
+}
+
+func (e *Emitter) DisconnectSockets() error {
+	return e.publish(adapter.DISCONNECT_SOCKETS, adapter.DisconnectSocketsData{
+		Opts: e.opts,
+	})
+}
+
+// ServerSideEmit reaches the OnServerSide handlers of every server. It
+// cannot wait for acknowledgements.
+func (e *Emitter) ServerSideEmit(event string, agrs ...interface{}) error {
+	return e.publish(adapter.SERVER_SIDE_EMIT, append([]interface{}{event}, agrs...))
+}
+
+func (e *Emitter) publish(t adapter.MessageType, data interface{}) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return e.bus.Publish(adapter.Message{
+		Type: t,
+		Node: e.uid,
+		Nsp:  e.nsp,
+		Data: raw,
+	})
+}
@@ -0,0 +1,133 @@
+package emitter
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/doquangtan/socketio/v4"
+	"github.com/doquangtan/socketio/v4/adapter"
+	gWebsocket "github.com/gorilla/websocket"
+)
+
+// client is a Socket.IO client connected to the root namespace.
+type client struct {
+	t    *testing.T
+	conn *gWebsocket.Conn
+	sid  string
+}
+
+func dial(t *testing.T, srv *httptest.Server) *client {
+	conn, _, err := gWebsocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/socket.io/?EIO=4&transport=websocket", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	c := &client{t: t, conn: conn}
+	c.read()
+	c.send("40")
+	var connect struct {
+		SID string `json:"sid"`
+	}
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(c.read(), "40")), &connect); err != nil {
+		t.Fatal(err)
+	}
+	c.sid = connect.SID
+	return c
+}
+
+func (c *client) send(packet string) {
+	if err := c.conn.WriteMessage(gWebsocket.TextMessage, []byte(packet)); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// read returns the next packet, skipping the pings.
+func (c *client) read() string {
+	c.t.Helper()
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		_, m, err := c.conn.ReadMessage()
+		if err != nil {
+			c.t.Fatal(err)
+		}
+		if string(m) != "2" {
+			return strings.TrimSuffix(string(m), "\n")
+		}
+	}
+}
+
+func (c *client) expect(want string) {
+	c.t.Helper()
+	if got := c.read(); got != want {
+		c.t.Fatalf("packet %q, want %q", got, want)
+	}
+}
+
+func TestEmitter(t *testing.T) {
+	hub := adapter.NewMemoryHub()
+	io := socketio.New(socketio.WithAdapter(hub.Bus()))
+	srv := httptest.NewServer(io)
+	bus := hub.Bus()
+	t.Cleanup(func() {
+		srv.Close()
+		io.Close()
+		bus.Close()
+	})
+	jobs := make(chan []interface{}, 1)
+	io.OnServerSide("job", func(e *socketio.EventPayload) { jobs <- e.Data })
+	io.Of("/admin")
+	a, b := dial(t, srv), dial(t, srv)
+	e := New(bus)
+
+	// Every emit ends with one to all the sockets, so that a socket left out
+	// reads it first.
+	e.Except(b.sid).SocketsJoin("room1")
+	e.To("room1").Emit("hello", "world")
+	e.Emit("all")
+	a.expect(`42["hello","world"]`)
+	a.expect(`42["all"]`)
+	b.expect(`42["all"]`)
+
+	e.To("room1").Except(a.sid).Emit("nobody")
+	e.Except("room1").Emit("others")
+	e.Emit("all")
+	a.expect(`42["all"]`)
+	b.expect(`42["others"]`)
+	b.expect(`42["all"]`)
+
+	e.SocketsLeave("room1")
+	e.To("room1").Emit("nobody")
+	e.Emit("all")
+	a.expect(`42["all"]`)
+	b.expect(`42["all"]`)
+
+	a.send("40/admin,")
+	if got := a.read(); !strings.HasPrefix(got, "40/admin,{") {
+		t.Fatalf("CONNECT /admin answered %q", got)
+	}
+	e.Of("admin").Emit("admins")
+	e.Emit("all")
+	a.expect(`42/admin,["admins"]`)
+	a.expect(`42["all"]`)
+	b.expect(`42["all"]`)
+
+	if err := e.ServerSideEmit("job", 1); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case data := <-jobs:
+		if len(data) != 1 || data[0] != float64(1) {
+			t.Errorf("server-side event %v", data)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server-side event not received")
+	}
+
+	e.Except(a.sid).DisconnectSockets()
+	b.expect("41")
+	e.Emit("all")
+	a.expect(`42["all"]`)
+}
@@ -0,0 +1,73 @@
+package engineio
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// HTTPCompression configures the compression of polling responses.
+type HTTPCompression struct {
+	// Threshold is the size from which responses are compressed, 1024 bytes
+	// by default.
+	Threshold int
+	// Brotli offers br to the clients that accept it, before gzip and
+	// deflate.
+	Brotli bool
+}
+
+// encoding returns the content coding to compress the response to r with,
+// "" when the client accepts none.
+func (c *HTTPCompression) encoding(r *http.Request) string {
+	if c == nil {
+		return ""
+	}
+	supported := []string{"gzip", "deflate"}
+	if c.Brotli {
+		supported = []string{"br", "gzip", "deflate"}
+	}
+	accepted := map[string]float64{}
+	for _, item := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(item), ";")
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			q, _ = strconv.ParseFloat(value, 64)
+		}
+		if name != "" {
+			accepted[strings.ToLower(name)] = q
+		}
+	}
+	best, bestQ := "", 0.0
+	for _, encoding := range supported {
+		q, ok := accepted[encoding]
+		if !ok {
+			q = accepted["*"]
+		}
+		if q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+	return best
+}
+
+func compressTo(w io.Writer, encoding string, payload string) error {
+	var cw io.WriteCloser
+	switch encoding {
+	case "br":
+		cw = brotli.NewWriter(w)
+	case "gzip":
+		cw = gzip.NewWriter(w)
+	default:
+		cw = zlib.NewWriter(w)
+	}
+	if _, err := io.WriteString(cw, payload); err != nil {
+		cw.Close()
+		return err
+	}
+	return cw.Close()
+}
@@ -0,0 +1,57 @@
+package engineio
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestFlushPollingCompression(t *testing.T) {
+	large := "4" + strings.Repeat("x", 2000)
+	tests := []struct {
+		name        string
+		compression *HTTPCompression
+		packet      string
+		compress    bool
+		encoding    string
+		vary        bool
+	}{
+		{name: "disabled", packet: large, compress: true},
+		{name: "below threshold", compression: &HTTPCompression{}, packet: "4hi", compress: true, vary: true},
+		{name: "uncompressed packet", compression: &HTTPCompression{}, packet: large, vary: true},
+		{name: "compressed", compression: &HTTPCompression{}, packet: large, compress: true, encoding: "gzip", vary: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewServer(Config{HTTPCompression: tt.compression})
+			polling := &Polling{}
+			polling.push(tt.packet, tt.compress)
+			r := httptest.NewRequest("GET", "/engine.io/?EIO=4&transport=polling", nil)
+			r.Header.Set("Accept-Encoding", "gzip")
+			w := httptest.NewRecorder()
+			if err := s.flushPolling(w, r, polling); err != nil {
+				t.Fatal(err)
+			}
+			if got := w.Header().Get("Vary"); (got == "Accept-Encoding") != tt.vary {
+				t.Errorf("Vary = %q", got)
+			}
+			if got := w.Header().Get("Content-Encoding"); got != tt.encoding {
+				t.Errorf("Content-Encoding = %q, want %q", got, tt.encoding)
+			}
+			var body io.Reader = w.Body
+			if tt.encoding == "gzip" {
+				zr, err := gzip.NewReader(w.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				body = zr
+			}
+			got, _ := io.ReadAll(body)
+			if string(got) != tt.packet {
+				t.Errorf("body of %d bytes, want %d", len(got), len(tt.packet))
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package engineio
+
+import (
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Cookie configures the cookie holding the session id, which load balancers
+// can use for sticky sessions.
+type Cookie struct {
+	// Name defaults to "io".
+	Name string
+	// Path defaults to "/".
+	Path     string
+	HTTPOnly bool
+	// SameSite defaults to http.SameSiteLaxMode.
+	SameSite http.SameSite
+	Secure   bool
+	// MaxAge is in seconds, the cookie lasting for the browser session when 0.
+	MaxAge int
+}
+
+// header returns the Set-Cookie header value of the session sid.
+func (c *Cookie) header(sid string) string {
+	return (&http.Cookie{
+		Name:     c.Name,
+		Value:    sid,
+		Path:     c.Path,
+		HttpOnly: c.HTTPOnly,
+		SameSite: c.SameSite,
+		Secure:   c.Secure,
+		MaxAge:   c.MaxAge,
+	}).String()
+}
+
+// setCookie adds the session cookie to the response header h.
+func (s *Server) setCookie(h http.Header, sid string) {
+	if s.config.Cookie != nil {
+		h.Add("Set-Cookie", s.config.Cookie.header(sid))
+	}
+}
+
+func (s *Server) setFiberCookie(ctx *fiber.Ctx, sid string) {
+	if s.config.Cookie != nil {
+		ctx.Response().Header.Add(fiber.HeaderSetCookie, s.config.Cookie.header(sid))
+	}
+}
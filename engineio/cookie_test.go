@@ -0,0 +1,99 @@
+package engineio
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	gWebsocket "github.com/gorilla/websocket"
+)
+
+// sessionCookie checks the io cookie the response sets for the session sid.
+func sessionCookie(t *testing.T, res *http.Response, sid string) {
+	t.Helper()
+	var cookies []*http.Cookie
+	for _, cookie := range res.Cookies() {
+		if cookie.Name == "io" {
+			cookies = append(cookies, cookie)
+		}
+	}
+	if len(cookies) != 1 {
+		t.Fatalf("Set-Cookie %q", res.Header.Values("Set-Cookie"))
+	}
+	cookie := cookies[0]
+	if cookie.Value != sid || cookie.Path != "/" || !cookie.HttpOnly || cookie.SameSite != http.SameSiteStrictMode {
+		t.Errorf("cookie %q for session %q", cookie.Raw, sid)
+	}
+}
+
+var cookieConfig = Config{Cookie: &Cookie{HTTPOnly: true, SameSite: http.SameSiteStrictMode}}
+
+func TestCookiePolling(t *testing.T) {
+	_, endpoint, sessions := newTestServer(t, cookieConfig)
+	res, _ := request(t, http.MethodGet, endpoint+"?EIO=4&transport=polling", "")
+	session := receive(t, sessions)
+	sessionCookie(t, res, session.ID())
+
+	// Only the handshake sets it.
+	res, _ = request(t, http.MethodPost, endpoint+"?EIO=4&transport=polling&sid="+session.ID(), "6")
+	if cookies := res.Header.Values("Set-Cookie"); len(cookies) != 0 {
+		t.Errorf("POST sets %q", cookies)
+	}
+
+	_, endpoint, _ = newTestServer(t, Config{})
+	if res, _ := request(t, http.MethodGet, endpoint+"?EIO=4&transport=polling", ""); len(res.Cookies()) != 0 {
+		t.Errorf("cookie %q without Config.Cookie", res.Header.Values("Set-Cookie"))
+	}
+}
+
+func TestCookieUpgrade(t *testing.T) {
+	_, endpoint, sessions := newTestServer(t, cookieConfig)
+	url := "ws" + strings.TrimPrefix(endpoint, "http")
+
+	conn, res, err := gWebsocket.DefaultDialer.Dial(url+"?EIO=4&transport=websocket", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	sessionCookie(t, res, receive(t, sessions).ID())
+
+	// The upgrade of a polling session sets it again.
+	sid, _ := handshake(t, endpoint)
+	receive(t, sessions)
+	conn, res, err = gWebsocket.DefaultDialer.Dial(url+"?EIO=4&transport=websocket&sid="+sid, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	sessionCookie(t, res, sid)
+}
+
+func TestCookieFiberUpgrade(t *testing.T) {
+	s := NewServer(cookieConfig)
+	sessions := make(chan *Session, 1)
+	s.OnConnection(func(session *Session) { sessions <- session })
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.All("/engine.io/", s.FiberHandler)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go app.Listener(ln)
+	t.Cleanup(func() {
+		app.Shutdown()
+		s.Close()
+	})
+
+	// The header set before the upgrade survives the hijack of fasthttp.
+	conn, res, err := gWebsocket.DefaultDialer.Dial("ws://"+ln.Addr().String()+"/engine.io/?EIO=4&transport=websocket", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	sessionCookie(t, res, receive(t, sessions).ID())
+
+	res, _ = request(t, http.MethodGet, "http://"+ln.Addr().String()+"/engine.io/?EIO=4&transport=polling", "")
+	sessionCookie(t, res, receive(t, sessions).ID())
+}
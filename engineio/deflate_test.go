@@ -0,0 +1,188 @@
+package engineio
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	gWebsocket "github.com/gorilla/websocket"
+)
+
+// jsonPayload returns a JSON array of chat-like messages of about size bytes,
+// numbered from start.
+func jsonPayload(size int, start int) []byte {
+	type message struct {
+		ID     int               `json:"id"`
+		Room   string            `json:"room"`
+		User   string            `json:"user"`
+		Text   string            `json:"text"`
+		Tags   []string          `json:"tags"`
+		Meta   map[string]string `json:"meta"`
+		Unread bool              `json:"unread"`
+	}
+	var messages []message
+	for i := start; ; i++ {
+		messages = append(messages, message{
+			ID:     i,
+			Room:   fmt.Sprintf("room-%d", i%7),
+			User:   fmt.Sprintf("user-%d", i%13),
+			Text:   fmt.Sprintf("message %d about order #%d", i, i*31),
+			Tags:   []string{"chat", "order"},
+			Meta:   map[string]string{"client": "web", "locale": "en-US"},
+			Unread: i%3 == 0,
+		})
+		data, _ := json.Marshal(messages)
+		if len(data) >= size {
+			return data
+		}
+	}
+}
+
+func dialDeflate(t testing.TB, config Config) (*gWebsocket.Conn, string, <-chan *Session) {
+	sessions := make(chan *Session, 1)
+	s := NewServer(config)
+	s.OnConnection(func(session *Session) { sessions <- session })
+	srv := httptest.NewServer(s)
+	t.Cleanup(func() {
+		srv.Close()
+		s.Close()
+	})
+	dialer := gWebsocket.Dialer{EnableCompression: true}
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/engine.io/?EIO=4&transport=websocket"
+	conn, res, err := dialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	if _, _, err := conn.ReadMessage(); err != nil {
+		t.Fatal(err)
+	}
+	return conn, res.Header.Get("Sec-WebSocket-Extensions"), sessions
+}
+
+func TestPerMessageDeflateNegotiation(t *testing.T) {
+	_, extensions, _ := dialDeflate(t, Config{})
+	if extensions != "" {
+		t.Errorf("extensions %q without PerMessageDeflate", extensions)
+	}
+	conn, extensions, sessions := dialDeflate(t, Config{PerMessageDeflate: &PerMessageDeflate{}})
+	// Context takeover is not supported by the websocket libraries.
+	if !strings.Contains(extensions, "permessage-deflate") || !strings.Contains(extensions, "server_no_context_takeover") {
+		t.Fatalf("extensions %q", extensions)
+	}
+	session := <-sessions
+	payload := append([]byte("4"), jsonPayload(4096, 0)...)
+	for _, compress := range []bool{true, false} {
+		if err := session.WritePacket(payload, compress); err != nil {
+			t.Fatal(err)
+		}
+		_, got, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, payload) {
+			t.Fatalf("received %d bytes, want %d", len(got), len(payload))
+		}
+	}
+}
+
+var payloadSizes = []int{4 << 10, 8 << 10, 16 << 10, 40 << 10}
+
+// BenchmarkDeflate compresses typical payloads each on its own, as
+// PerMessageDeflate does, and with the context taken over from the previous
+// messages, which the websocket libraries do not negotiate.
+func BenchmarkDeflate(b *testing.B) {
+	for _, size := range payloadSizes {
+		// Successive messages differ, as they would on a real connection.
+		payloads := make([][]byte, 16)
+		for i := range payloads {
+			payloads[i] = jsonPayload(size, i*1000)
+		}
+		b.Run(fmt.Sprintf("%dKB/message", size>>10), func(b *testing.B) {
+			var buf bytes.Buffer
+			w, _ := flate.NewWriter(&buf, flate.BestSpeed)
+			in, out := 0, 0
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				payload := payloads[i%len(payloads)]
+				buf.Reset()
+				w.Reset(&buf)
+				w.Write(payload)
+				w.Flush()
+				in, out = in+len(payload), out+buf.Len()
+			}
+			checkInflate(b, buf.Bytes(), payloads[(b.N-1)%len(payloads)])
+			b.SetBytes(int64(in / b.N))
+			b.ReportMetric(float64(in)/float64(out), "ratio")
+		})
+		b.Run(fmt.Sprintf("%dKB/takeover", size>>10), func(b *testing.B) {
+			var buf bytes.Buffer
+			w, _ := flate.NewWriter(&buf, flate.BestSpeed)
+			in, out := 0, 0
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				payload := payloads[i%len(payloads)]
+				buf.Reset()
+				w.Write(payload)
+				w.Flush()
+				in, out = in+len(payload), out+buf.Len()
+			}
+			b.SetBytes(int64(in / b.N))
+			b.ReportMetric(float64(in)/float64(out), "ratio")
+		})
+	}
+}
+
+func checkInflate(b *testing.B, compressed []byte, want []byte) {
+	got, err := io.ReadAll(flate.NewReader(io.MultiReader(bytes.NewReader(compressed), strings.NewReader("\x01\x00\x00\xff\xff"))))
+	if err != nil || !bytes.Equal(got, want) {
+		b.Fatalf("inflated %d bytes, %v", len(got), err)
+	}
+	if len(compressed) >= len(want) {
+		b.Fatalf("compressed to %d bytes from %d", len(compressed), len(want))
+	}
+}
+
+// BenchmarkWritePacket sends typical payloads to a websocket client, with and
+// without PerMessageDeflate.
+func BenchmarkWritePacket(b *testing.B) {
+	for _, size := range payloadSizes {
+		payload := append([]byte("4"), jsonPayload(size, 0)...)
+		for _, compress := range []bool{false, true} {
+			b.Run(fmt.Sprintf("%dKB/compress=%v", size>>10, compress), func(b *testing.B) {
+				conn, _, sessions := dialDeflate(b, Config{PerMessageDeflate: &PerMessageDeflate{}})
+				session := <-sessions
+				received := make(chan error, 1)
+				go func() {
+					for i := 0; i < b.N; i++ {
+						_, got, err := conn.ReadMessage()
+						if err == nil && !bytes.Equal(got, payload) {
+							err = fmt.Errorf("received %d bytes, want %d", len(got), len(payload))
+						}
+						if err != nil {
+							received <- err
+							return
+						}
+					}
+					received <- nil
+				}()
+				b.SetBytes(int64(len(payload)))
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if err := session.WritePacket(payload, compress); err != nil {
+						b.Fatal(err)
+					}
+				}
+				if err := <-received; err != nil {
+					b.Fatal(err)
+				}
+			})
+		}
+	}
+}
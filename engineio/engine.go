@@ -19,14 +19,6 @@ const (
 	NOOP
 )
 
-// Code	Message
-// 0	"Transport unknown"
-// 1	"Session ID unknown"
-// 2	"Bad handshake method"
-// 3	"Bad request"
-// 4	"Forbidden"
-// 5	"Unsupported protocol version"
-
 func (id PacketType) String() string {
 	return strconv.Itoa(int(id))
 }
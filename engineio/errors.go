@@ -0,0 +1,153 @@
+package engineio
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+)
+
+// ErrorCode is the code of a request the server rejects, answered as
+// {"code":N,"message":"..."}.
+type ErrorCode int
+
+const (
+	UNKNOWN_TRANSPORT ErrorCode = iota
+	UNKNOWN_SID
+	BAD_HANDSHAKE_METHOD
+	BAD_REQUEST
+	FORBIDDEN
+	UNSUPPORTED_PROTOCOL_VERSION
+)
+
+var errorMessages = []string{
+	"Transport unknown",
+	"Session ID unknown",
+	"Bad handshake method",
+	"Bad request",
+	"Forbidden",
+	"Unsupported protocol version",
+}
+
+func (c ErrorCode) String() string {
+	if c < 0 || int(c) >= len(errorMessages) {
+		return "Unknown error"
+	}
+	return errorMessages[c]
+}
+
+// ConnectionError describes a rejected request. Context tells more about
+// the cause, e.g. {"sid": "..."} for UNKNOWN_SID.
+type ConnectionError struct {
+	Req     *http.Request          `json:"-"`
+	Code    ErrorCode              `json:"code"`
+	Message string                 `json:"message"`
+	Context map[string]interface{} `json:"-"`
+}
+
+func newConnectionError(code ErrorCode, context map[string]interface{}) *ConnectionError {
+	return &ConnectionError{
+		Code:    code,
+		Message: code.String(),
+		Context: context,
+	}
+}
+
+func (e *ConnectionError) Error() string {
+	return e.Message
+}
+
+func (e *ConnectionError) status() int {
+	if e.Code == FORBIDDEN {
+		return http.StatusForbidden
+	}
+	return http.StatusBadRequest
+}
+
+// OnConnectionError sets the handler of rejected requests, e.g. to monitor
+// clients polling sessions that are gone.
+func (s *Server) OnConnectionError(fn func(err *ConnectionError)) {
+	s.onConnectionError = fn
+}
+
+// verify checks the transport, protocol version and session of a request,
+// returning the session it belongs to, nil for a handshake.
+func (s *Server) verify(query url.Values, method string, upgrade bool) (int, *Session, *ConnectionError) {
+	transport := query.Get("transport")
+	if transport != "polling" && transport != "websocket" {
+		return 0, nil, newConnectionError(UNKNOWN_TRANSPORT, map[string]interface{}{
+			"transport": transport,
+		})
+	}
+	eio, ok := s.eioVersion(query.Get("EIO"))
+	if !ok {
+		return 0, nil, newConnectionError(UNSUPPORTED_PROTOCOL_VERSION, map[string]interface{}{
+			"protocol": query.Get("EIO"),
+		})
+	}
+	if transport == "websocket" && !upgrade {
+		return 0, nil, newConnectionError(BAD_REQUEST, map[string]interface{}{
+			"name":    "TRANSPORT_HANDSHAKE_ERROR",
+			"message": "unexpected transport without upgrade",
+		})
+	}
+	if j := query.Get("j"); j != "" && (!s.config.JSONP || strings.Trim(j, "0123456789") != "") {
+		return 0, nil, newConnectionError(BAD_REQUEST, map[string]interface{}{
+			"name": "INVALID_JSONP_INDEX",
+			"j":    j,
+		})
+	}
+
+	sid := query.Get("sid")
+	if sid == "" {
+		if method != http.MethodGet {
+			return 0, nil, newConnectionError(BAD_HANDSHAKE_METHOD, map[string]interface{}{
+				"method": method,
+			})
+		}
+		return eio, nil, nil
+	}
+	session := s.sessions.get(sid)
+	if session == nil {
+		return 0, nil, newConnectionError(UNKNOWN_SID, map[string]interface{}{
+			"sid": sid,
+		})
+	}
+	// Polling requests and upgrades both need a session still on polling.
+	if previous := session.Transport(); previous != "polling" {
+		return 0, nil, newConnectionError(BAD_REQUEST, map[string]interface{}{
+			"name":              "TRANSPORT_MISMATCH",
+			"transport":         transport,
+			"previousTransport": previous,
+		})
+	}
+	return eio, session, nil
+}
+
+// abort answers the request with the JSON of the error, then reports it to
+// the OnConnectionError handler.
+func (s *Server) abort(w http.ResponseWriter, r *http.Request, err *ConnectionError) {
+	body, _ := json.Marshal(err)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(err.status())
+	w.Write(body)
+	err.Req = r
+	s.connectionError(err)
+}
+
+// abortFiber is abort for the websocket upgrades of Fiber.
+func (s *Server) abortFiber(ctx *fiber.Ctx, err *ConnectionError) error {
+	ret := ctx.Status(err.status()).JSON(err)
+	err.Req, _ = adaptor.ConvertRequest(ctx, false)
+	s.connectionError(err)
+	return ret
+}
+
+func (s *Server) connectionError(err *ConnectionError) {
+	if s.onConnectionError != nil {
+		s.onConnectionError(err)
+	}
+}
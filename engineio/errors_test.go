@@ -0,0 +1,179 @@
+package engineio
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var errorTests = []struct {
+	name    string
+	method  string
+	query   string
+	upgrade bool
+	status  int
+	body    string
+	context map[string]interface{}
+}{
+	{
+		name:    "unknown transport",
+		query:   "EIO=4&transport=flash",
+		status:  http.StatusBadRequest,
+		body:    `{"code":0,"message":"Transport unknown"}`,
+		context: map[string]interface{}{"transport": "flash"},
+	},
+	{
+		name:    "unknown sid",
+		query:   "EIO=4&transport=polling&sid=gone",
+		status:  http.StatusBadRequest,
+		body:    `{"code":1,"message":"Session ID unknown"}`,
+		context: map[string]interface{}{"sid": "gone"},
+	},
+	{
+		name:    "unknown sid upgrade",
+		query:   "EIO=4&transport=websocket&sid=gone",
+		upgrade: true,
+		status:  http.StatusBadRequest,
+		body:    `{"code":1,"message":"Session ID unknown"}`,
+		context: map[string]interface{}{"sid": "gone"},
+	},
+	{
+		name:    "bad handshake method",
+		method:  http.MethodPost,
+		query:   "EIO=4&transport=polling",
+		status:  http.StatusBadRequest,
+		body:    `{"code":2,"message":"Bad handshake method"}`,
+		context: map[string]interface{}{"method": "POST"},
+	},
+	{
+		name:    "websocket without upgrade",
+		query:   "EIO=4&transport=websocket",
+		status:  http.StatusBadRequest,
+		body:    `{"code":3,"message":"Bad request"}`,
+		context: map[string]interface{}{"name": "TRANSPORT_HANDSHAKE_ERROR", "message": "unexpected transport without upgrade"},
+	},
+	{
+		name:    "invalid JSONP index",
+		query:   "EIO=4&transport=polling&j=alert(1)",
+		status:  http.StatusBadRequest,
+		body:    `{"code":3,"message":"Bad request"}`,
+		context: map[string]interface{}{"name": "INVALID_JSONP_INDEX", "j": "alert(1)"},
+	},
+	{
+		name:    "EIO3 not allowed",
+		query:   "EIO=3&transport=polling",
+		status:  http.StatusBadRequest,
+		body:    `{"code":5,"message":"Unsupported protocol version"}`,
+		context: map[string]interface{}{"protocol": "3"},
+	},
+	{
+		name:    "unsupported protocol upgrade",
+		query:   "EIO=5&transport=websocket",
+		upgrade: true,
+		status:  http.StatusBadRequest,
+		body:    `{"code":5,"message":"Unsupported protocol version"}`,
+		context: map[string]interface{}{"protocol": "5"},
+	},
+}
+
+func upgradeHeaders(h http.Header) {
+	h.Set("Connection", "Upgrade")
+	h.Set("Upgrade", "websocket")
+	h.Set("Sec-WebSocket-Version", "13")
+	h.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+}
+
+// checkConnectionError checks the answer to a rejected request and the error
+// reported for it.
+func checkConnectionError(t *testing.T, res *http.Response, reported <-chan *ConnectionError, query string, status int, body string, context map[string]interface{}) {
+	t.Helper()
+	data, _ := io.ReadAll(res.Body)
+	if res.StatusCode != status {
+		t.Errorf("status %d, want %d", res.StatusCode, status)
+	}
+	if got := res.Header.Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type %q", got)
+	}
+	if string(data) != body {
+		t.Errorf("body %s, want %s", data, body)
+	}
+	select {
+	case err := <-reported:
+		if err.Req == nil || err.Req.URL.RawQuery != query {
+			t.Errorf("request %v reported", err.Req)
+		}
+		if !reflect.DeepEqual(err.Context, context) {
+			t.Errorf("context %v, want %v", err.Context, context)
+		}
+	default:
+		t.Error("OnConnectionError not called")
+	}
+}
+
+func TestAbort(t *testing.T) {
+	for _, test := range errorTests {
+		t.Run(test.name, func(t *testing.T) {
+			s := NewServer(Config{})
+			defer s.Close()
+			reported := make(chan *ConnectionError, 1)
+			s.OnConnectionError(func(err *ConnectionError) { reported <- err })
+			method := test.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			r := httptest.NewRequest(method, "/engine.io/?"+test.query, nil)
+			if test.upgrade {
+				upgradeHeaders(r.Header)
+			}
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, r)
+			checkConnectionError(t, w.Result(), reported, test.query, test.status, test.body, test.context)
+		})
+	}
+}
+
+func TestAbortFiber(t *testing.T) {
+	for _, test := range errorTests {
+		t.Run(test.name, func(t *testing.T) {
+			s := NewServer(Config{})
+			defer s.Close()
+			reported := make(chan *ConnectionError, 1)
+			s.OnConnectionError(func(err *ConnectionError) { reported <- err })
+			app := fiber.New()
+			app.All("/engine.io/", s.FiberHandler)
+			method := test.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			r := httptest.NewRequest(method, "/engine.io/?"+test.query, nil)
+			if test.upgrade {
+				upgradeHeaders(r.Header)
+			}
+			res, err := app.Test(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkConnectionError(t, res, reported, test.query, test.status, test.body, test.context)
+		})
+	}
+}
+
+func TestConnectionErrorStatus(t *testing.T) {
+	for code := UNKNOWN_TRANSPORT; code <= UNSUPPORTED_PROTOCOL_VERSION; code++ {
+		want := http.StatusBadRequest
+		if code == FORBIDDEN {
+			want = http.StatusForbidden
+		}
+		err := newConnectionError(code, nil)
+		if err.status() != want || err.Message != errorMessages[code] || err.Error() != err.Message {
+			t.Errorf("%d: status %d, message %q", code, err.status(), err.Message)
+		}
+	}
+	if got := ErrorCode(42).String(); got != "Unknown error" {
+		t.Errorf("unknown code %q", got)
+	}
+}
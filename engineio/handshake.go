@@ -1,9 +1,15 @@
 package engineio
 
 import (
+	"fmt"
+	"net"
 	"net/http"
+	"net/netip"
 	"net/url"
+	"strings"
 	"time"
+
+	"github.com/gofiber/fiber/v2"
 )
 
 // Handshake represents the Socket.IO handshake data
@@ -14,9 +20,9 @@ type Handshake struct {
 	// Query params of the initial request
 	Query url.Values `json:"query"`
 
-	// Auth is the authentication payload sent by the client
-	// e.g: { "token": "abc123" }
-	Auth HandshakeAuth `json:"auth"`
+	// Auth is the authentication payload sent by the client in the CONNECT
+	// packet of the namespace, e.g: { "token": "abc123" }
+	Auth map[string]interface{} `json:"auth"`
 
 	// Time is the date of creation as string
 	Time string `json:"time"`
@@ -37,10 +43,6 @@ type Handshake struct {
 	Secure bool `json:"secure"`
 }
 
-type HandshakeAuth struct {
-	Token string `json:"token"`
-}
-
 type ConnParameters struct {
 	PingInterval time.Duration
 	PingTimeout  time.Duration
@@ -82,3 +84,101 @@ func (p ConnParameters) ToJson() jsonParameters {
 	}
 	return arg
 }
+
+type trustedProxies []netip.Prefix
+
+// parseTrustedProxies parses IPs and CIDR ranges, IPv4-mapped IPv6 ones
+// matching the IPv4 clients.
+func parseTrustedProxies(list ...string) (trustedProxies, error) {
+	ret := trustedProxies{}
+	for _, item := range list {
+		if prefix, err := netip.ParsePrefix(item); err == nil {
+			if prefix.Addr().Is4In6() && prefix.Bits() >= 96 {
+				prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+			}
+			ret = append(ret, prefix.Masked())
+		} else if addr, err := netip.ParseAddr(item); err == nil {
+			ret = append(ret, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+		} else {
+			return nil, fmt.Errorf("engineio: invalid trusted proxy %q", item)
+		}
+	}
+	return ret, nil
+}
+
+func (t trustedProxies) contains(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range t {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientAddress returns the IP of the client. X-Forwarded-For is only
+// honoured when the request comes from a trusted proxy, and is walked from
+// the right so that entries injected by the client are ignored.
+func (t trustedProxies) clientAddress(remoteAddr string, header http.Header) string {
+	address := remoteAddr
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		address = host
+	}
+	if !t.contains(address) {
+		return address
+	}
+	hops := []string{}
+	for _, value := range header.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(value, ",") {
+			if hop = strings.TrimSpace(hop); hop != "" {
+				hops = append(hops, hop)
+			}
+		}
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		address = hops[i]
+		if !t.contains(address) {
+			break
+		}
+	}
+	return address
+}
+
+func (t trustedProxies) newHandshake(header http.Header, query url.Values, uri string, remoteAddr string, secure bool) Handshake {
+	now := time.Now()
+	if !secure {
+		if host, _, err := net.SplitHostPort(remoteAddr); err == nil && t.contains(host) {
+			secure = strings.EqualFold(header.Get("X-Forwarded-Proto"), "https")
+		}
+	}
+	return Handshake{
+		Headers: header,
+		Query:   query,
+		Auth:    map[string]interface{}{},
+		Time:    now.Format(time.RFC1123Z),
+		Issued:  now.UnixMilli(),
+		URL:     uri,
+		Address: t.clientAddress(remoteAddr, header),
+		Xdomain: header.Get("Origin") != "",
+		Secure:  secure,
+	}
+}
+
+func (t trustedProxies) httpHandshake(r *http.Request) Handshake {
+	return t.newHandshake(r.Header, r.URL.Query(), r.RequestURI, r.RemoteAddr, r.TLS != nil)
+}
+
+func (t trustedProxies) fiberHandshake(ctx *fiber.Ctx) Handshake {
+	header := http.Header{}
+	for key, values := range ctx.GetReqHeaders() {
+		for _, value := range values {
+			header.Add(key, value)
+		}
+	}
+	query, _ := url.ParseQuery(string(ctx.Request().URI().QueryString()))
+	return t.newHandshake(header, query, ctx.OriginalURL(), ctx.Context().RemoteAddr().String(), ctx.Context().IsTLS())
+}
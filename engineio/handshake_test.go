@@ -0,0 +1,117 @@
+package engineio
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestParseTrustedProxies(t *testing.T) {
+	for _, item := range []string{"10.0.0.300", "proxy.internal", "10.0.0.0/33", ""} {
+		if _, err := parseTrustedProxies("127.0.0.1", item); err == nil {
+			t.Errorf("%q accepted", item)
+		}
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("NewServer accepted an invalid trusted proxy")
+		}
+	}()
+	NewServer(Config{TrustedProxies: []string{"10.0.0.0/8", "proxy.internal"}})
+}
+
+func TestClientAddress(t *testing.T) {
+	proxies, err := parseTrustedProxies("10.0.0.0/8", "::1", "::ffff:192.168.0.0/112")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		want       string
+	}{
+		{"direct", "203.0.113.7:5000", nil, "203.0.113.7"},
+		{"untrusted remote", "203.0.113.7:5000", []string{"1.2.3.4"}, "203.0.113.7"},
+		{"trusted remote", "10.0.0.1:5000", []string{"1.2.3.4"}, "1.2.3.4"},
+		{"trusted remote without header", "10.0.0.1:5000", nil, "10.0.0.1"},
+		{"spoofed leftmost entry", "10.0.0.1:5000", []string{"6.6.6.6, 1.2.3.4"}, "1.2.3.4"},
+		{"chained trusted proxies", "10.0.0.1:5000", []string{"6.6.6.6, 1.2.3.4, 10.0.0.3", "10.0.0.2"}, "1.2.3.4"},
+		{"only trusted hops", "10.0.0.1:5000", []string{"10.0.0.3, 10.0.0.2"}, "10.0.0.3"},
+		{"IPv6 remote", "[::1]:5000", []string{"2001:db8::1"}, "2001:db8::1"},
+		{"IPv4-mapped remote", "[::ffff:10.0.0.1]:5000", []string{"1.2.3.4"}, "1.2.3.4"},
+		{"IPv4-mapped hop", "10.0.0.1:5000", []string{"1.2.3.4, ::ffff:10.0.0.2"}, "1.2.3.4"},
+		{"IPv4-mapped range", "192.168.1.1:5000", []string{"1.2.3.4"}, "1.2.3.4"},
+		{"untrusted IPv4-mapped remote", "[::ffff:203.0.113.7]:5000", []string{"1.2.3.4"}, "::ffff:203.0.113.7"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			header := http.Header{}
+			for _, value := range test.forwarded {
+				header.Add("X-Forwarded-For", value)
+			}
+			if got := proxies.clientAddress(test.remoteAddr, header); got != test.want {
+				t.Errorf("address %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestForwardedProto(t *testing.T) {
+	proxies, _ := parseTrustedProxies("10.0.0.0/8")
+	header := http.Header{"X-Forwarded-Proto": {"https"}}
+	if !proxies.newHandshake(header, nil, "/", "10.0.0.1:5000", false).Secure {
+		t.Error("X-Forwarded-Proto of a trusted proxy ignored")
+	}
+	if proxies.newHandshake(header, nil, "/", "203.0.113.7:5000", false).Secure {
+		t.Error("X-Forwarded-Proto of an untrusted client used")
+	}
+}
+
+func TestFiberHandshake(t *testing.T) {
+	tests := []struct {
+		name    string
+		proxies []string
+		want    string
+	}{
+		{"trusted", []string{"127.0.0.1"}, "1.2.3.4"},
+		{"untrusted", []string{"10.0.0.0/8"}, "127.0.0.1"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			proxies, err := parseTrustedProxies(test.proxies...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			app := fiber.New(fiber.Config{DisableStartupMessage: true})
+			app.Get("/", func(ctx *fiber.Ctx) error {
+				handshake := proxies.fiberHandshake(ctx)
+				if handshake.Query.Get("EIO") != "4" {
+					t.Errorf("query %v", handshake.Query)
+				}
+				return ctx.SendString(handshake.Address)
+			})
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			go app.Listener(ln)
+			t.Cleanup(func() { app.Shutdown() })
+
+			req, _ := http.NewRequest(http.MethodGet, "http://"+ln.Addr().String()+"/?EIO=4", nil)
+			req.Header.Set("X-Forwarded-For", "6.6.6.6, 1.2.3.4")
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+			address, _ := io.ReadAll(res.Body)
+			if string(address) != test.want {
+				t.Errorf("address %q, want %q", address, test.want)
+			}
+		})
+	}
+}
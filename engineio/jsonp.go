@@ -0,0 +1,32 @@
+package engineio
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// flushPolling answers a poll with the buffered packets, compressed when the
+// client accepts it.
+func (s *Server) flushPolling(w http.ResponseWriter, r *http.Request, polling *Polling) error {
+	threshold := 0
+	if s.config.HTTPCompression != nil {
+		threshold = s.config.HTTPCompression.Threshold
+		// Every response depends on Accept-Encoding, compressed or not, so
+		// that caches do not serve one to a client that can't decode it.
+		w.Header().Add("Vary", "Accept-Encoding")
+	}
+	return polling.flush(w, r.URL.Query().Get("j"), s.config.HTTPCompression.encoding(r), threshold)
+}
+
+var jsonpNewlines = strings.NewReplacer(`\\n`, `\n`, `\n`, "\n")
+
+// jsonpBody extracts the payload of a JSONP POST, sent as the "d" field of a
+// form whose newlines the client escaped.
+func jsonpBody(body []byte) []byte {
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil
+	}
+	return []byte(jsonpNewlines.Replace(form.Get("d")))
+}
@@ -0,0 +1,103 @@
+package engineio
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestJSONPBody(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"packet", "d=" + url.QueryEscape("4hello"), "4hello"},
+		{"escaped newline", "d=" + url.QueryEscape(`4a\nb`), "4a\nb"},
+		{"escaped backslash", "d=" + url.QueryEscape(`4a\\nb`), `4a\nb`},
+		{"payload", "d=" + url.QueryEscape("4a\x1e4b"), "4a\x1e4b"},
+		{"other fields", "x=1&d=4hi", "4hi"},
+		{"missing", "x=1", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := string(jsonpBody([]byte(test.body))); got != test.want {
+				t.Errorf("jsonpBody(%q) = %q, want %q", test.body, got, test.want)
+			}
+		})
+	}
+	if got := jsonpBody([]byte("d=%zz")); got != nil {
+		t.Errorf("invalid form decoded to %q", got)
+	}
+}
+
+func TestFlushJSONP(t *testing.T) {
+	polling := &Polling{}
+	polling.Push(`4he said "hi"` + "\n</script>")
+	polling.Push("4é")
+	w := httptest.NewRecorder()
+	if err := polling.FlushJSONP(w, "3"); err != nil {
+		t.Fatal(err)
+	}
+	if got := w.Header().Get("Content-Type"); got != "text/javascript; charset=UTF-8" {
+		t.Errorf("Content-Type %q", got)
+	}
+	body := w.Body.String()
+	if !strings.HasPrefix(body, "___eio[3](") || !strings.HasSuffix(body, ");") {
+		t.Fatalf("script %q", body)
+	}
+	// The argument is a string literal that neither ends the script nor the
+	// string early.
+	literal := strings.TrimSuffix(strings.TrimPrefix(body, "___eio[3]("), ");")
+	if strings.ContainsAny(literal, "\n<>") {
+		t.Errorf("unescaped characters in %s", literal)
+	}
+	var payload string
+	if err := json.Unmarshal([]byte(literal), &payload); err != nil {
+		t.Fatal(err)
+	}
+	if want := `4he said "hi"` + "\n</script>\x1e4é"; payload != want {
+		t.Errorf("payload %q, want %q", payload, want)
+	}
+	if err := polling.FlushJSONP(httptest.NewRecorder(), "3"); err != ErrBuf {
+		t.Errorf("empty flush = %v", err)
+	}
+}
+
+func TestJSONPPolling(t *testing.T) {
+	_, endpoint, sessions := newTestServer(t, Config{JSONP: true})
+	res, body := request(t, http.MethodGet, endpoint+"?EIO=4&transport=polling&j=0", "")
+	if res.StatusCode != http.StatusOK || !strings.HasPrefix(body, `___eio[0]("0{`) {
+		t.Fatalf("handshake answered %d %q", res.StatusCode, body)
+	}
+	session := receive(t, sessions)
+	messages := make(chan string, 2)
+	session.OnMessage(func(data string) { messages <- data })
+	pollURL := endpoint + "?EIO=4&transport=polling&j=1&sid=" + session.ID()
+
+	form := url.Values{"d": {`4line\none` + "\x1e" + `4two`}}
+	res, body = request(t, http.MethodPost, pollURL, form.Encode())
+	if res.StatusCode != http.StatusOK || body != "ok" {
+		t.Fatalf("POST answered %d %q", res.StatusCode, body)
+	}
+	for _, want := range []string{"line\none", "two"} {
+		if got := receive(t, messages); got != want {
+			t.Errorf("message %q, want %q", got, want)
+		}
+	}
+
+	session.Send("hi")
+	if _, body := request(t, http.MethodGet, pollURL, ""); body != `___eio[1]("4hi");` {
+		t.Errorf("poll answered %q", body)
+	}
+}
+
+func TestJSONPDisabled(t *testing.T) {
+	_, endpoint, _ := newTestServer(t, Config{})
+	if res, _ := request(t, http.MethodGet, endpoint+"?EIO=4&transport=polling&j=0", ""); res.StatusCode != http.StatusBadRequest {
+		t.Errorf("JSONP handshake answered %d without JSONP", res.StatusCode)
+	}
+}
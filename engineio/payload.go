@@ -0,0 +1,156 @@
+package engineio
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+const separator = "\x1e"
+
+var ErrPayload = errors.New("invalid payload")
+
+// PayloadPacket is one packet of a polling payload, Binary being set for
+// binary packets.
+type PayloadPacket struct {
+	Data   string
+	Binary []byte
+}
+
+// EncodePayload joins packets with the record separator, or prefixes each
+// with its length, counted in UTF-16 units, for Engine.IO v3.
+func EncodePayload(packets []string, eio3 bool) string {
+	if !eio3 {
+		return strings.Join(packets, separator)
+	}
+	var b strings.Builder
+	for _, packet := range packets {
+		b.WriteString(strconv.Itoa(utf16Len(packet)))
+		b.WriteByte(':')
+		b.WriteString(packet)
+	}
+	return b.String()
+}
+
+// DecodePayload splits the body of a polling POST. binary tells whether the
+// body is an Engine.IO v3 binary payload (application/octet-stream).
+func DecodePayload(body []byte, binary bool, eio3 bool) ([]PayloadPacket, error) {
+	if !eio3 {
+		ret := []PayloadPacket{}
+		for _, packet := range strings.Split(string(body), separator) {
+			if len(packet) == 0 {
+				continue
+			}
+			ret = append(ret, decodeText(packet, "b"))
+		}
+		return ret, nil
+	}
+	if binary {
+		return decodeBinaryPayload(body)
+	}
+	return decodeLengthPrefixed(string(body))
+}
+
+func decodeText(packet string, binaryPrefix string) PayloadPacket {
+	if strings.HasPrefix(packet, binaryPrefix) {
+		if data, err := base64.StdEncoding.DecodeString(packet[len(binaryPrefix):]); err == nil {
+			return PayloadPacket{Binary: data}
+		}
+	}
+	return PayloadPacket{Data: packet}
+}
+
+func decodeLengthPrefixed(payload string) ([]PayloadPacket, error) {
+	ret := []PayloadPacket{}
+	for len(payload) > 0 {
+		colon := strings.IndexByte(payload, ':')
+		if colon == -1 {
+			return ret, ErrPayload
+		}
+		length, err := strconv.Atoi(payload[:colon])
+		if err != nil || length < 0 {
+			return ret, ErrPayload
+		}
+		payload = payload[colon+1:]
+		end := utf16Offset(payload, length)
+		if end == -1 {
+			return ret, ErrPayload
+		}
+		if end > 0 {
+			ret = append(ret, decodeText(payload[:end], "b4"))
+		}
+		payload = payload[end:]
+	}
+	return ret, nil
+}
+
+// maxLengthDigits bounds the length of a binary payload packet, well above
+// any MaxPayload, so that it cannot overflow.
+const maxLengthDigits = 10
+
+// decodeBinaryPayload decodes packets of the form <0|1><length digits><0xff>
+// <data>, 0 being a text packet and 1 a binary one.
+func decodeBinaryPayload(body []byte) ([]PayloadPacket, error) {
+	ret := []PayloadPacket{}
+	for len(body) > 0 {
+		if body[0] > 1 {
+			return ret, ErrPayload
+		}
+		isBinary := body[0] == 1
+		length := 0
+		i := 1
+		for ; i < len(body) && body[i] != 0xff; i++ {
+			if body[i] > 9 || i > maxLengthDigits {
+				return ret, ErrPayload
+			}
+			length = length*10 + int(body[i])
+		}
+		if i == len(body) {
+			return ret, ErrPayload
+		}
+		i++
+		if length <= 0 || length > len(body)-i {
+			return ret, ErrPayload
+		}
+		data := body[i : i+length]
+		body = body[i+length:]
+		if isBinary {
+			// Drop the packet type byte of the message.
+			ret = append(ret, PayloadPacket{Binary: append([]byte{}, data[1:]...)})
+		} else {
+			ret = append(ret, PayloadPacket{Data: string(data)})
+		}
+	}
+	return ret, nil
+}
+
+func runeUnits(r rune) int {
+	if r >= 0x10000 {
+		return 2
+	}
+	return 1
+}
+
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += runeUnits(r)
+	}
+	return n
+}
+
+// utf16Offset returns the byte offset of s after n UTF-16 units, or -1.
+func utf16Offset(s string, n int) int {
+	units := 0
+	for i, r := range s {
+		if units == n {
+			return i
+		}
+		units += runeUnits(r)
+	}
+	if units == n {
+		return len(s)
+	}
+	return -1
+}
@@ -0,0 +1,86 @@
+package engineio
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestEncodePayload(t *testing.T) {
+	packets := []string{"4hello", "4€😀", "2"}
+	if got := EncodePayload(packets, false); got != "4hello\x1e4€😀\x1e2" {
+		t.Errorf("EncodePayload v4 = %q", got)
+	}
+	if got := EncodePayload(packets, true); got != "6:4hello4:4€😀1:2" {
+		t.Errorf("EncodePayload v3 = %q", got)
+	}
+}
+
+func TestDecodePayload(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   []byte
+		binary bool
+		eio3   bool
+		want   []PayloadPacket
+	}{
+		{
+			name: "v4",
+			body: []byte("4hello\x1ebAQI="),
+			want: []PayloadPacket{{Data: "4hello"}, {Binary: []byte{1, 2}}},
+		},
+		{
+			name: "v3 length prefixed",
+			body: []byte("4:4€😀6:b4AQ=="),
+			eio3: true,
+			want: []PayloadPacket{{Data: "4€😀"}, {Binary: []byte{1}}},
+		},
+		{
+			name:   "v3 binary",
+			body:   []byte{0, 3, 0xff, '4', 'h', 'i', 1, 3, 0xff, 4, 1, 2},
+			binary: true,
+			eio3:   true,
+			want:   []PayloadPacket{{Data: "4hi"}, {Binary: []byte{1, 2}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecodePayload(tt.body, tt.binary, tt.eio3)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DecodePayload = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeBinaryPayloadInvalid(t *testing.T) {
+	tests := map[string][]byte{
+		"overflowing length": append(append([]byte{1}, bytes.Repeat([]byte{9}, 19)...), 0xff, 'x'),
+		"non digit length":   {0, 'a', 0xff, '4'},
+		"unknown type":       {2, 1, 0xff, '4'},
+		"no separator":       {0, 1, 2},
+		"empty packet":       {0, 0xff},
+		"zero length":        {1, 0, 0xff, 4},
+		"truncated data":     {0, 5, 0xff, '4', 'h'},
+		"too many digits":    append(append([]byte{0}, bytes.Repeat([]byte{0}, 11)...), 0xff),
+	}
+	for name, body := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := DecodePayload(body, true, true); err != ErrPayload {
+				t.Errorf("DecodePayload error = %v, want ErrPayload", err)
+			}
+		})
+	}
+}
+
+func FuzzDecodePayload(f *testing.F) {
+	f.Add([]byte{0, 3, 0xff, '4', 'h', 'i', 1, 3, 0xff, 4, 1, 2}, true, true)
+	f.Add([]byte("4:4€😀6:b4AQ=="), false, true)
+	f.Add([]byte("4hello\x1ebAQI="), false, false)
+	f.Fuzz(func(t *testing.T, body []byte, binary bool, eio3 bool) {
+		DecodePayload(body, binary, eio3)
+	})
+}
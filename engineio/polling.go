@@ -0,0 +1,189 @@
+package engineio
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+)
+
+var (
+	ErrNilPolling = errors.New("nil *Polling")
+	ErrBuf        = errors.New("nil buf")
+)
+
+type closeWrapper struct {
+	io.WriteCloser
+	writeToBuff func(packet string)
+}
+
+// Close implements [io.WriteCloser].
+func (c closeWrapper) Close() error {
+	return nil
+}
+
+// Write implements [io.WriteCloser].
+func (c closeWrapper) Write(p []byte) (n int, err error) {
+	c.writeToBuff(string(p))
+	return 0, nil
+}
+
+type Polling struct {
+	mu      sync.RWMutex
+	writer  closeWrapper
+	buf     []string
+	drained chan struct{}
+	// compress is set once a buffered packet may be sent compressed.
+	compress bool
+	Ready    chan struct{}
+	// EIO3 selects the length-prefixed payload encoding of Engine.IO v3.
+	EIO3 bool
+}
+
+func (c *Polling) Push(packet string) {
+	c.push(packet, false)
+}
+
+func (c *Polling) push(packet string, compress bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.buf = append(c.buf, packet)
+	c.compress = c.compress || compress
+	select {
+	case c.Ready <- struct{}{}:
+	default:
+	}
+}
+
+// PushBinary buffers a binary packet, base64 encoded as polling payloads
+// are text.
+func (c *Polling) PushBinary(data []byte) {
+	c.pushBinary(data, false)
+}
+
+func (c *Polling) pushBinary(data []byte, compress bool) {
+	prefix := "b"
+	if c.EIO3 {
+		prefix = "b4"
+	}
+	c.push(prefix+base64.StdEncoding.EncodeToString(data), compress)
+}
+
+func (c *Polling) NextWriter(messageType int) (io.WriteCloser, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c == nil {
+		return nil, ErrNilPolling
+	}
+	if c.writer.writeToBuff == nil {
+		c.writer.writeToBuff = c.Push
+	}
+	return c.writer, nil
+}
+
+func (c *Polling) Flush(w http.ResponseWriter) error {
+	return c.flush(w, "", "", 0)
+}
+
+// FlushJSONP writes the buffered packets as the ___eio[index]("...") script
+// of JSONP polling.
+func (c *Polling) FlushJSONP(w http.ResponseWriter, index string) error {
+	return c.flush(w, index, "", 0)
+}
+
+// flush writes the buffered packets, as a JSONP script when jsonp is set. The
+// payload is compressed with encoding from threshold bytes when one of the
+// packets allows it.
+func (c *Polling) flush(w http.ResponseWriter, jsonp string, encoding string, threshold int) error {
+	payload, compress, err := c.take()
+	if err != nil {
+		return err
+	}
+	if jsonp != "" {
+		quoted, _ := json.Marshal(payload)
+		payload = fmt.Sprintf("___eio[%s](%s);", jsonp, quoted)
+		w.Header().Set("Content-Type", "text/javascript; charset=UTF-8")
+	} else {
+		w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
+	}
+	if !compress || encoding == "" || len(payload) < threshold {
+		fmt.Fprint(w, payload)
+		return nil
+	}
+	w.Header().Set("Content-Encoding", encoding)
+	return compressTo(w, encoding, payload)
+}
+
+func (c *Polling) take() (string, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.buf) == 0 {
+		return "", false, ErrBuf
+	}
+	payload, compress := EncodePayload(c.buf, c.EIO3), c.compress
+	c.buf = nil
+	c.compress = false
+	if c.drained != nil {
+		close(c.drained)
+		c.drained = nil
+	}
+	return payload, compress, nil
+}
+
+// drain empties the buffer, returning the packets the poller did not fetch.
+func (c *Polling) drain() []PayloadPacket {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	prefix := "b"
+	if c.EIO3 {
+		prefix = "b4"
+	}
+	ret := make([]PayloadPacket, 0, len(c.buf))
+	for _, packet := range c.buf {
+		ret = append(ret, decodeText(packet, prefix))
+	}
+	c.buf = nil
+	c.compress = false
+	if c.drained != nil {
+		close(c.drained)
+		c.drained = nil
+	}
+	return ret
+}
+
+// WaitBelow blocks until fewer than n packets are buffered, returning false
+// if done is closed first.
+func (c *Polling) WaitBelow(n int, done <-chan struct{}) bool {
+	return c.waitBelow(n, done, nil)
+}
+
+func (c *Polling) waitBelow(n int, done <-chan struct{}, closed <-chan struct{}) bool {
+	for {
+		c.mu.Lock()
+		if len(c.buf) < n {
+			c.mu.Unlock()
+			return true
+		}
+		if c.drained == nil {
+			c.drained = make(chan struct{})
+		}
+		drained := c.drained
+		c.mu.Unlock()
+
+		select {
+		case <-drained:
+		case <-done:
+			return false
+		case <-closed:
+			return false
+		}
+	}
+}
+
+func (c *Polling) Close() error {
+	c.Push(NOOP.String())
+	return nil
+}
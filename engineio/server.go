@@ -0,0 +1,431 @@
+package engineio
+
+import (
+	"compress/flate"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/gofiber/websocket/v2"
+	"github.com/google/uuid"
+	gWebsocket "github.com/gorilla/websocket"
+)
+
+type Config struct {
+	// PingInterval and PingTimeout default to 25s: a client that does not
+	// answer a ping within PingTimeout is disconnected.
+	PingInterval time.Duration
+	PingTimeout  time.Duration
+	// MaxPayload is announced to the clients, 1000000 bytes by default.
+	MaxPayload int
+	// AllowEIO3 accepts the Engine.IO v3 clients, which ping the server.
+	AllowEIO3 bool
+	// JSONP answers the polls with a "j" query parameter with
+	// ___eio[j]("...") scripts.
+	JSONP bool
+	// TrustedProxies lists the proxies, as IPs or CIDR ranges, whose
+	// X-Forwarded-For and X-Forwarded-Proto headers fill the handshake.
+	// NewServer panics on an entry that is neither.
+	TrustedProxies []string
+	// GenerateID returns the id of a new session, a UUID by default.
+	GenerateID func() string
+	// PerMessageDeflate compresses the websocket messages of the clients
+	// that support it. Nil disables compression.
+	PerMessageDeflate *PerMessageDeflate
+	// HTTPCompression compresses the polling responses of the clients that
+	// accept gzip, deflate or br. Nil disables compression.
+	HTTPCompression *HTTPCompression
+	// Cookie is set to the session id on the handshake and websocket upgrade
+	// responses. Nil sets no cookie.
+	Cookie *Cookie
+}
+
+// PerMessageDeflate configures the permessage-deflate websocket extension.
+// Each message is compressed on its own: gorilla and fasthttp websocket only
+// negotiate the extension without context takeover, and offer no way to
+// override it, so there is no option for it.
+type PerMessageDeflate struct {
+	// Threshold is the size from which messages are compressed, 1024 bytes
+	// by default.
+	Threshold int
+	// Level is a compress/flate level, flate.BestSpeed when 0.
+	Level int
+}
+
+// Server is an Engine.IO server: it runs the handshake, the polling and
+// websocket transports, the upgrade from one to the other and the heartbeat,
+// and hands the messages of each client to its Session.
+//
+//	engine := engineio.NewServer(engineio.Config{})
+//	engine.OnConnection(func(session *engineio.Session) {
+//		session.OnMessage(func(data string) {
+//			session.Send("echo " + data)
+//		})
+//	})
+//	http.Handle("/engine.io/", engine)
+type Server struct {
+	config            Config
+	proxies           trustedProxies
+	upgrader          gWebsocket.Upgrader
+	sessions          sessions
+	onConnection      func(session *Session)
+	onConnectionError func(err *ConnectionError)
+	cancel            context.CancelFunc
+}
+
+func NewServer(config Config) *Server {
+	if config.PingInterval <= 0 {
+		config.PingInterval = 25000 * time.Millisecond
+	}
+	if config.PingTimeout <= 0 {
+		config.PingTimeout = 25000 * time.Millisecond
+	}
+	if config.MaxPayload <= 0 {
+		config.MaxPayload = 1000000
+	}
+	if config.GenerateID == nil {
+		config.GenerateID = uuid.NewString
+	}
+	if config.PerMessageDeflate != nil {
+		deflate := *config.PerMessageDeflate
+		if deflate.Threshold <= 0 {
+			deflate.Threshold = 1024
+		}
+		if deflate.Level == 0 {
+			deflate.Level = flate.BestSpeed
+		}
+		config.PerMessageDeflate = &deflate
+	}
+	if config.HTTPCompression != nil {
+		compression := *config.HTTPCompression
+		if compression.Threshold <= 0 {
+			compression.Threshold = 1024
+		}
+		config.HTTPCompression = &compression
+	}
+	if config.Cookie != nil {
+		cookie := *config.Cookie
+		if cookie.Name == "" {
+			cookie.Name = "io"
+		}
+		if cookie.Path == "" {
+			cookie.Path = "/"
+		}
+		if cookie.SameSite == 0 {
+			cookie.SameSite = http.SameSiteLaxMode
+		}
+		config.Cookie = &cookie
+	}
+	proxies, err := parseTrustedProxies(config.TrustedProxies...)
+	if err != nil {
+		panic(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Server{
+		config:  config,
+		proxies: proxies,
+		sessions: sessions{
+			list: make(map[string]*Session),
+		},
+		cancel: cancel,
+	}
+	s.upgrader = gWebsocket.Upgrader{
+		CheckOrigin:       func(r *http.Request) bool { return true },
+		EnableCompression: config.PerMessageDeflate != nil,
+		Error: func(w http.ResponseWriter, r *http.Request, status int, reason error) {
+			s.abort(w, r, newConnectionError(BAD_REQUEST, map[string]interface{}{
+				"name":    "TRANSPORT_HANDSHAKE_ERROR",
+				"message": reason.Error(),
+			}))
+		},
+	}
+	go s.heartbeat(ctx)
+	return s
+}
+
+// OnConnection sets the handler of new sessions. It runs before the first
+// message of the client is read.
+func (s *Server) OnConnection(fn func(session *Session)) {
+	s.onConnection = fn
+}
+
+// Close stops the heartbeat and closes every session.
+func (s *Server) Close() {
+	s.cancel()
+	for _, session := range s.sessions.all() {
+		session.Close()
+	}
+}
+
+func (s *Server) heartbeat(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(1 * time.Second))
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			for _, session := range s.sessions.all() {
+				session.heartbeat(now)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	eio, session, err := s.verify(query, r.Method, gWebsocket.IsWebSocketUpgrade(r))
+	if err != nil {
+		s.abort(w, r, err)
+		return
+	}
+	if query.Get("transport") == "websocket" {
+		sid := s.sessionID(session)
+		header := http.Header{}
+		s.setCookie(header, sid)
+		c, err := s.upgrader.Upgrade(w, r, header)
+		if err != nil {
+			return
+		}
+		s.serveWebsocket(c, sid, eio, session, func() Handshake {
+			return s.proxies.httpHandshake(r)
+		})
+		return
+	}
+	switch {
+	case session == nil:
+		s.handleHandshake(w, r, eio)
+	case r.Method == http.MethodGet:
+		s.handlePoll(w, r, session)
+	case r.Method == http.MethodPost:
+		s.handlePost(w, r, session)
+	default:
+		s.abort(w, r, newConnectionError(BAD_REQUEST, map[string]interface{}{
+			"method": r.Method,
+		}))
+	}
+}
+
+// FiberHandler serves the Engine.IO requests of a Fiber route.
+func (s *Server) FiberHandler(ctx *fiber.Ctx) error {
+	if ctx.Query("transport") != "websocket" || !websocket.IsWebSocketUpgrade(ctx) {
+		return adaptor.HTTPHandler(s)(ctx)
+	}
+	query, _ := url.ParseQuery(string(ctx.Request().URI().QueryString()))
+	eio, session, err := s.verify(query, ctx.Method(), true)
+	if err != nil {
+		return s.abortFiber(ctx, err)
+	}
+	handshake := s.proxies.fiberHandshake(ctx)
+	sid := s.sessionID(session)
+	s.setFiberCookie(ctx, sid)
+	return websocket.New(func(c *websocket.Conn) {
+		s.serveWebsocket(c, sid, eio, session, func() Handshake {
+			return handshake
+		})
+	}, websocket.Config{
+		EnableCompression: s.config.PerMessageDeflate != nil,
+	})(ctx)
+}
+
+// eioVersion returns the Engine.IO protocol version of the EIO query
+// parameter, v3 only being accepted with AllowEIO3.
+func (s *Server) eioVersion(eio string) (int, bool) {
+	switch eio {
+	case "4":
+		return 4, true
+	case "3":
+		return 3, s.config.AllowEIO3
+	}
+	return 0, false
+}
+
+// sessionID returns the id of session, or a new one to open a session with.
+func (s *Server) sessionID(session *Session) string {
+	if session != nil {
+		return session.id
+	}
+	return s.config.GenerateID()
+}
+
+func (s *Server) newSession(id string, eio int, handshake Handshake) *Session {
+	now := time.Now()
+	session := &Session{
+		id:        id,
+		eio:       eio,
+		handshake: handshake,
+		server:    s,
+		done:      make(chan struct{}),
+		nextPing:  now.Add(s.config.PingInterval),
+	}
+	if eio == 3 {
+		session.deadline = now.Add(s.config.PingInterval + s.config.PingTimeout)
+	}
+	return session
+}
+
+// open sends the handshake of a new session, then hands it to the
+// OnConnection handler.
+func (s *Server) open(session *Session, upgrades []string) {
+	s.sessions.set(session)
+	session.write(OPEN, ConnParameters{
+		SID:          session.id,
+		PingInterval: s.config.PingInterval,
+		PingTimeout:  s.config.PingTimeout,
+		MaxPayload:   s.config.MaxPayload,
+		Upgrades:     upgrades,
+	}.ToJson())
+	if s.onConnection != nil {
+		s.onConnection(session)
+	}
+}
+
+func (s *Server) serveWebsocket(c wsConn, sid string, eio int, session *Session, handshake func() Handshake) {
+	defer c.Close()
+	if deflate := s.config.PerMessageDeflate; deflate != nil {
+		c.SetCompressionLevel(deflate.Level)
+	}
+	if session == nil {
+		session = s.newSession(sid, eio, handshake())
+		session.ws = c
+		s.open(session, []string{})
+	} else if !s.probe(session, c) {
+		return
+	}
+	defer session.close("transport close")
+
+	for {
+		messageType, message, err := c.ReadMessage()
+		if err != nil {
+			return
+		}
+		if messageType == gWebsocket.TextMessage {
+			session.receive(string(message))
+		} else if messageType == gWebsocket.BinaryMessage {
+			if session.eio == 3 && len(message) > 0 {
+				// Engine.IO v3 binary frames start with the message packet type.
+				message = message[1:]
+			}
+			session.receiveBinary(message)
+		}
+	}
+}
+
+// probe runs the upgrade of a polling session: the client pings "probe" over
+// the websocket, pauses polling once answered, then sends UPGRADE.
+func (s *Server) probe(session *Session, c wsConn) bool {
+	for {
+		messageType, message, err := c.ReadMessage()
+		if err != nil {
+			return false
+		}
+		if messageType != gWebsocket.TextMessage {
+			continue
+		}
+		switch string(message) {
+		case PING.String() + "probe":
+			w, err := c.NextWriter(gWebsocket.TextMessage)
+			if err != nil {
+				return false
+			}
+			WriteTo(w, PONG, map[string]interface{}{
+				"raw": "probe",
+			})
+			w.Close()
+			// Ends the pending poll so that the client can pause polling.
+			if _, polling := session.transport(); polling != nil {
+				polling.Close()
+			}
+		case UPGRADE.String():
+			session.upgrade(c)
+			return true
+		}
+	}
+}
+
+func (s *Server) handleHandshake(w http.ResponseWriter, r *http.Request, eio int) {
+	session := s.newSession(s.config.GenerateID(), eio, s.proxies.httpHandshake(r))
+	s.setCookie(w.Header(), session.id)
+	session.polling = &Polling{
+		Ready: make(chan struct{}, 1),
+		EIO3:  eio == 3,
+	}
+	s.open(session, []string{"websocket"})
+	s.flushPolling(w, r, session.polling)
+}
+
+func (s *Server) handlePoll(w http.ResponseWriter, r *http.Request, session *Session) {
+	_, polling := session.transport()
+	if polling == nil {
+		s.abort(w, r, newConnectionError(UNKNOWN_SID, map[string]interface{}{
+			"sid": session.id,
+		}))
+		return
+	}
+
+	if s.flushPolling(w, r, polling) == nil {
+		return
+	}
+
+	// Nothing buffered: long-poll until a packet is written.
+	timeout := time.NewTimer(s.config.PingInterval)
+	defer timeout.Stop()
+	for {
+		select {
+		case <-polling.Ready:
+			if s.flushPolling(w, r, polling) == nil {
+				return
+			}
+		case <-timeout.C:
+			polling.Push(NOOP.String())
+			s.flushPolling(w, r, polling)
+			return
+		case <-session.done:
+			s.flushPolling(w, r, polling)
+			return
+		case <-r.Context().Done():
+			session.close("transport close")
+			return
+		}
+	}
+}
+
+func (s *Server) handlePost(w http.ResponseWriter, r *http.Request, session *Session) {
+	jsonp := r.URL.Query().Get("j")
+	body, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		s.abort(w, r, newConnectionError(BAD_REQUEST, map[string]interface{}{
+			"name":    "TRANSPORT_ERROR",
+			"message": err.Error(),
+		}))
+		return
+	}
+	if jsonp != "" {
+		body = jsonpBody(body)
+	}
+	packets, err := DecodePayload(body, r.Header.Get("Content-Type") == "application/octet-stream", session.eio == 3)
+	if err != nil {
+		s.abort(w, r, newConnectionError(BAD_REQUEST, map[string]interface{}{
+			"name":    "TRANSPORT_PARSE_ERROR",
+			"message": err.Error(),
+		}))
+		return
+	}
+
+	for _, packet := range packets {
+		if packet.Binary != nil {
+			session.receiveBinary(packet.Binary)
+			continue
+		}
+		session.receive(packet.Data)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
+	fmt.Fprint(w, "ok")
+}
@@ -0,0 +1,343 @@
+package engineio
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	gWebsocket "github.com/gorilla/websocket"
+)
+
+// newTestServer serves s and returns the URL of its endpoint, with the
+// sessions it opens.
+func newTestServer(t testing.TB, config Config) (*Server, string, <-chan *Session) {
+	sessions := make(chan *Session, 4)
+	s := NewServer(config)
+	s.OnConnection(func(session *Session) { sessions <- session })
+	srv := httptest.NewServer(s)
+	t.Cleanup(func() {
+		srv.Close()
+		s.Close()
+	})
+	return s, srv.URL + "/engine.io/", sessions
+}
+
+func request(t testing.TB, method string, url string, body string) (*http.Response, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	return res, string(data)
+}
+
+// handshake opens a polling session, returning its id and the answer.
+func handshake(t testing.TB, url string) (string, jsonParameters) {
+	t.Helper()
+	res, body := request(t, http.MethodGet, url+"?EIO=4&transport=polling", "")
+	if res.StatusCode != http.StatusOK || !strings.HasPrefix(body, "0") {
+		t.Fatalf("handshake answered %d %q", res.StatusCode, body)
+	}
+	var params jsonParameters
+	if err := json.Unmarshal([]byte(body[1:]), &params); err != nil {
+		t.Fatal(err)
+	}
+	return params.SID, params
+}
+
+func dial(t testing.TB, url string) *gWebsocket.Conn {
+	t.Helper()
+	conn, _, err := gWebsocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(url, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func readText(t testing.TB, conn *gWebsocket.Conn) string {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	messageType, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if messageType != gWebsocket.TextMessage {
+		t.Fatalf("binary message %v", data)
+	}
+	return string(data)
+}
+
+func receive[T any](t testing.TB, c <-chan T) T {
+	t.Helper()
+	select {
+	case v := <-c:
+		return v
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out")
+	}
+	panic("unreachable")
+}
+
+func TestHandshake(t *testing.T) {
+	_, url, sessions := newTestServer(t, Config{
+		PingInterval: 300 * time.Millisecond,
+		PingTimeout:  200 * time.Millisecond,
+		MaxPayload:   1000,
+	})
+	res, body := request(t, http.MethodGet, url+"?EIO=4&transport=polling&token=abc", "")
+	if res.StatusCode != http.StatusOK || res.Header.Get("Content-Type") != "text/plain; charset=UTF-8" {
+		t.Fatalf("handshake answered %d %q", res.StatusCode, res.Header.Get("Content-Type"))
+	}
+	var params jsonParameters
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(body, "0")), &params); err != nil {
+		t.Fatalf("open packet %q: %v", body, err)
+	}
+	want := jsonParameters{SID: params.SID, Upgrades: []string{"websocket"}, PingInterval: 300, PingTimeout: 200, MaxPayload: 1000}
+	if params.SID == "" || strings.Join(params.Upgrades, ",") != "websocket" || params.PingInterval != want.PingInterval || params.PingTimeout != want.PingTimeout || params.MaxPayload != want.MaxPayload {
+		t.Errorf("open packet %+v, want %+v", params, want)
+	}
+	session := receive(t, sessions)
+	if session.ID() != params.SID || session.EIO() != 4 || session.Transport() != "polling" {
+		t.Errorf("session %s over %s, EIO %d", session.ID(), session.Transport(), session.EIO())
+	}
+	if h := session.Handshake(); h.Query.Get("token") != "abc" || h.Address != "127.0.0.1" || h.Secure {
+		t.Errorf("handshake %+v", h)
+	}
+
+	// Over websocket, there is nothing to upgrade to.
+	conn := dial(t, url+"?EIO=4&transport=websocket")
+	open := readText(t, conn)
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(open, "0")), &params); err != nil {
+		t.Fatalf("open packet %q: %v", open, err)
+	}
+	if len(params.Upgrades) != 0 {
+		t.Errorf("upgrades %v over websocket", params.Upgrades)
+	}
+	if session := receive(t, sessions); session.ID() != params.SID || session.Transport() != "websocket" {
+		t.Errorf("session %s over %s", session.ID(), session.Transport())
+	}
+}
+
+func TestPolling(t *testing.T) {
+	_, url, sessions := newTestServer(t, Config{})
+	sid, _ := handshake(t, url)
+	session := receive(t, sessions)
+	messages, binaries := make(chan string, 4), make(chan []byte, 4)
+	session.OnMessage(func(data string) { messages <- data })
+	session.OnBinary(func(data []byte) { binaries <- data })
+	url += "?EIO=4&transport=polling&sid=" + sid
+
+	res, body := request(t, http.MethodPost, url, "4hello\x1ebAQID\x1e4world")
+	if res.StatusCode != http.StatusOK || body != "ok" {
+		t.Fatalf("POST answered %d %q", res.StatusCode, body)
+	}
+	for _, want := range []string{"hello", "world"} {
+		if got := receive(t, messages); got != want {
+			t.Errorf("message %q, want %q", got, want)
+		}
+	}
+	if got := receive(t, binaries); string(got) != "\x01\x02\x03" {
+		t.Errorf("binary %v", got)
+	}
+
+	// Buffered packets are answered at once, in one payload.
+	session.Send("a")
+	session.SendBinary([]byte{1})
+	if _, body := request(t, http.MethodGet, url, ""); body != "4a\x1ebAQ==" {
+		t.Errorf("poll answered %q", body)
+	}
+
+	// Otherwise the poll waits for the next packet.
+	polled := make(chan string, 1)
+	go func() {
+		_, body := request(t, http.MethodGet, url, "")
+		polled <- body
+	}()
+	select {
+	case body := <-polled:
+		t.Fatalf("poll answered %q without packets", body)
+	case <-time.After(100 * time.Millisecond):
+	}
+	session.Send("b")
+	if body := receive(t, polled); body != "4b" {
+		t.Errorf("long poll answered %q", body)
+	}
+}
+
+func TestLongPollTimeout(t *testing.T) {
+	_, url, sessions := newTestServer(t, Config{PingInterval: 200 * time.Millisecond, PingTimeout: time.Minute})
+	sid, _ := handshake(t, url)
+	receive(t, sessions)
+	// The poll ends with a noop, or the ping of the heartbeat.
+	if _, body := request(t, http.MethodGet, url+"?EIO=4&transport=polling&sid="+sid, ""); body != "6" && body != "2" {
+		t.Errorf("poll answered %q", body)
+	}
+}
+
+func TestUpgrade(t *testing.T) {
+	_, url, sessions := newTestServer(t, Config{})
+	sid, _ := handshake(t, url)
+	session := receive(t, sessions)
+	messages := make(chan string, 1)
+	session.OnMessage(func(data string) { messages <- data })
+	pollURL := url + "?EIO=4&transport=polling&sid=" + sid
+
+	polled := make(chan string, 1)
+	go func() {
+		_, body := request(t, http.MethodGet, pollURL, "")
+		polled <- body
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	conn := dial(t, url+"?EIO=4&transport=websocket&sid="+sid)
+	conn.WriteMessage(gWebsocket.TextMessage, []byte("2probe"))
+	if got := readText(t, conn); got != "3probe" {
+		t.Fatalf("probe answered %q", got)
+	}
+	// The pending poll ends so that the client can pause polling.
+	if body := receive(t, polled); body != "6" {
+		t.Errorf("pending poll answered %q, want a noop", body)
+	}
+	if session.Transport() != "polling" {
+		t.Error("upgraded before the UPGRADE packet")
+	}
+
+	// Packets written while the client pauses polling are sent over the
+	// websocket once upgraded.
+	session.Send("a")
+	session.SendBinary([]byte{1, 2})
+	conn.WriteMessage(gWebsocket.TextMessage, []byte("5"))
+	if got := readText(t, conn); got != "4a" {
+		t.Errorf("first message %q", got)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if messageType, data, err := conn.ReadMessage(); err != nil || messageType != gWebsocket.BinaryMessage || string(data) != "\x01\x02" {
+		t.Errorf("second message %v %v, %v", messageType, data, err)
+	}
+	if session.Transport() != "websocket" {
+		t.Errorf("transport %s after the upgrade", session.Transport())
+	}
+
+	session.Send("b")
+	if got := readText(t, conn); got != "4b" {
+		t.Errorf("message %q", got)
+	}
+	conn.WriteMessage(gWebsocket.TextMessage, []byte("4c"))
+	if got := receive(t, messages); got != "c" {
+		t.Errorf("received %q", got)
+	}
+	if res, _ := request(t, http.MethodGet, pollURL, ""); res.StatusCode != http.StatusBadRequest {
+		t.Errorf("poll after the upgrade answered %d", res.StatusCode)
+	}
+}
+
+func TestHeartbeat(t *testing.T) {
+	_, url, sessions := newTestServer(t, Config{
+		PingInterval: 100 * time.Millisecond,
+		PingTimeout:  500 * time.Millisecond,
+	})
+
+	t.Run("answered", func(t *testing.T) {
+		conn := dial(t, url+"?EIO=4&transport=websocket")
+		readText(t, conn)
+		session := receive(t, sessions)
+		closed := make(chan string, 1)
+		session.OnClose(func(reason string) { closed <- reason })
+		// The heartbeat runs every second: answer the pings of a few rounds.
+		for end := time.Now().Add(2500 * time.Millisecond); time.Now().Before(end); {
+			if got := readText(t, conn); got != "2" {
+				t.Fatalf("message %q, want a ping", got)
+			}
+			conn.WriteMessage(gWebsocket.TextMessage, []byte("3"))
+		}
+		select {
+		case reason := <-closed:
+			t.Fatalf("closed with %q while answering pings", reason)
+		default:
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		conn := dial(t, url+"?EIO=4&transport=websocket")
+		readText(t, conn)
+		session := receive(t, sessions)
+		closed := make(chan string, 1)
+		session.OnClose(func(reason string) { closed <- reason })
+		if got := readText(t, conn); got != "2" {
+			t.Fatalf("message %q, want a ping", got)
+		}
+		if reason := receive(t, closed); reason != "ping timeout" {
+			t.Errorf("closed with %q", reason)
+		}
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				break
+			}
+		}
+	})
+}
+
+func TestCallbacks(t *testing.T) {
+	_, url, sessions := newTestServer(t, Config{})
+	tests := []struct {
+		name   string
+		close  func(conn *gWebsocket.Conn, session *Session)
+		reason string
+	}{
+		{"close packet", func(conn *gWebsocket.Conn, session *Session) {
+			conn.WriteMessage(gWebsocket.TextMessage, []byte("1"))
+		}, "transport close"},
+		{"transport closed", func(conn *gWebsocket.Conn, session *Session) {
+			conn.Close()
+		}, "transport close"},
+		{"forced close", func(conn *gWebsocket.Conn, session *Session) {
+			session.Close()
+		}, "forced close"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conn := dial(t, url+"?EIO=4&transport=websocket")
+			readText(t, conn)
+			session := receive(t, sessions)
+			messages, binaries, closed := make(chan string, 1), make(chan []byte, 1), make(chan string, 2)
+			session.OnMessage(func(data string) { messages <- data })
+			session.OnBinary(func(data []byte) { binaries <- data })
+			session.OnClose(func(reason string) { closed <- reason })
+
+			conn.WriteMessage(gWebsocket.TextMessage, []byte("4hello"))
+			if got := receive(t, messages); got != "hello" {
+				t.Errorf("message %q", got)
+			}
+			conn.WriteMessage(gWebsocket.BinaryMessage, []byte{1, 2})
+			if got := receive(t, binaries); string(got) != "\x01\x02" {
+				t.Errorf("binary %v", got)
+			}
+
+			test.close(conn, session)
+			if reason := receive(t, closed); reason != test.reason {
+				t.Errorf("closed with %q, want %q", reason, test.reason)
+			}
+			session.Close()
+			select {
+			case reason := <-closed:
+				t.Errorf("closed again with %q", reason)
+			case <-time.After(50 * time.Millisecond):
+			}
+			if err := session.Send("late"); err != ErrSessionClosed {
+				t.Errorf("Send after close = %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,330 @@
+package engineio
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	gWebsocket "github.com/gorilla/websocket"
+)
+
+var ErrSessionClosed = errors.New("session closed")
+
+// wsConn is a gorilla or Fiber websocket connection.
+type wsConn interface {
+	ReadMessage() (int, []byte, error)
+	NextWriter(messageType int) (io.WriteCloser, error)
+	EnableWriteCompression(enable bool)
+	SetCompressionLevel(level int) error
+	Close() error
+}
+
+// Session is the connection of one Engine.IO client, over polling until it
+// upgrades to websocket, or over websocket only.
+type Session struct {
+	sync.RWMutex
+	id        string
+	eio       int
+	handshake Handshake
+	server    *Server
+	ws        wsConn
+	polling   *Polling
+	writeMu   sync.Mutex
+	closed    bool
+	done      chan struct{}
+	// nextPing is when the server pings next, deadline when the session
+	// times out without hearing from the client.
+	nextPing  time.Time
+	deadline  time.Time
+	onMessage func(data string)
+	onBinary  func(data []byte)
+	onClose   func(reason string)
+}
+
+func (s *Session) ID() string {
+	return s.id
+}
+
+// EIO returns the protocol version of the client, 3 or 4.
+func (s *Session) EIO() int {
+	return s.eio
+}
+
+// Handshake returns the details of the request that opened the session.
+func (s *Session) Handshake() Handshake {
+	return s.handshake
+}
+
+// Transport returns "polling" or "websocket".
+func (s *Session) Transport() string {
+	s.RLock()
+	defer s.RUnlock()
+	if s.ws != nil {
+		return "websocket"
+	}
+	return "polling"
+}
+
+// OnMessage sets the handler of the text messages of the client.
+func (s *Session) OnMessage(fn func(data string)) {
+	s.Lock()
+	defer s.Unlock()
+	s.onMessage = fn
+}
+
+// OnBinary sets the handler of the binary messages of the client.
+func (s *Session) OnBinary(fn func(data []byte)) {
+	s.Lock()
+	defer s.Unlock()
+	s.onBinary = fn
+}
+
+// OnClose sets the handler called once the session is closed, with reason
+// "transport close", "ping timeout" or "forced close".
+func (s *Session) OnClose(fn func(reason string)) {
+	s.Lock()
+	defer s.Unlock()
+	s.onClose = fn
+}
+
+// Send writes a text message.
+func (s *Session) Send(data string) error {
+	return s.WritePacket([]byte(MESSAGE.String()+data), true)
+}
+
+// SendBinary writes a binary message, base64 encoded over polling.
+func (s *Session) SendBinary(data []byte) error {
+	return s.WriteBinary(data, true)
+}
+
+// WriteBinary writes a binary message, compressed over websocket when
+// compress is set and PerMessageDeflate enabled.
+func (s *Session) WriteBinary(data []byte, compress bool) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	ws, polling := s.transport()
+	if ws == nil {
+		if polling == nil {
+			return ErrSessionClosed
+		}
+		polling.pushBinary(data, compress)
+		return nil
+	}
+	if s.eio == 3 {
+		// Engine.IO v3 binary frames start with the message packet type.
+		data = append([]byte{byte(MESSAGE)}, data...)
+	}
+	return s.writeWebsocket(ws, gWebsocket.BinaryMessage, data, compress)
+}
+
+// WritePacket writes an encoded text packet, e.g. a message packet made with
+// WriteTo, so that a packet shared by many sessions is encoded once.
+func (s *Session) WritePacket(packet []byte, compress bool) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	ws, polling := s.transport()
+	if ws != nil {
+		return s.writeWebsocket(ws, gWebsocket.TextMessage, packet, compress)
+	}
+	if polling == nil {
+		return ErrSessionClosed
+	}
+	polling.push(string(packet), compress)
+	return nil
+}
+
+func (s *Session) write(t PacketType, arg ...interface{}) error {
+	var buf bytes.Buffer
+	WriteTo(&buf, t, arg...)
+	return s.WritePacket(buf.Bytes(), false)
+}
+
+// writeWebsocket writes a message, compressing it when it reaches the
+// threshold of PerMessageDeflate.
+func (s *Session) writeWebsocket(ws wsConn, messageType int, data []byte, compress bool) error {
+	if deflate := s.server.config.PerMessageDeflate; deflate != nil {
+		ws.EnableWriteCompression(compress && len(data) >= deflate.Threshold)
+	}
+	w, err := ws.NextWriter(messageType)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+func (s *Session) transport() (wsConn, *Polling) {
+	s.RLock()
+	defer s.RUnlock()
+	if s.closed {
+		return nil, nil
+	}
+	return s.ws, s.polling
+}
+
+// WaitBelow blocks while n packets or more wait for the poller, returning
+// false if done is closed or the session closes first. It returns at once on
+// websocket.
+func (s *Session) WaitBelow(n int, done <-chan struct{}) bool {
+	ws, polling := s.transport()
+	if ws != nil || polling == nil {
+		return true
+	}
+	return polling.waitBelow(n, done, s.done)
+}
+
+// Ping sends a ping packet, which the client answers with a pong.
+func (s *Session) Ping() error {
+	return s.write(PING)
+}
+
+func (s *Session) Close() {
+	s.close("forced close")
+}
+
+func (s *Session) close(reason string) {
+	s.Lock()
+	if s.closed {
+		s.Unlock()
+		return
+	}
+	s.closed = true
+	ws, polling, onClose := s.ws, s.polling, s.onClose
+	s.Unlock()
+	s.server.sessions.delete(s.id)
+	if polling != nil && ws == nil {
+		// Ends the pending poll, telling the client not to poll again.
+		polling.Push(CLOSE.String())
+	}
+	close(s.done)
+	if ws != nil {
+		ws.Close()
+	}
+	if onClose != nil {
+		onClose(reason)
+	}
+}
+
+// receive handles a text packet of the client.
+func (s *Session) receive(packet string) {
+	if packet == "" {
+		return
+	}
+	s.Lock()
+	if s.eio == 3 {
+		s.deadline = time.Now().Add(s.server.config.PingInterval + s.server.config.PingTimeout)
+	} else {
+		s.deadline = time.Time{}
+	}
+	onMessage := s.onMessage
+	s.Unlock()
+
+	switch packet[:1] {
+	case MESSAGE.String():
+		if onMessage != nil {
+			onMessage(packet[1:])
+		}
+	case PING.String():
+		// Engine.IO v3 clients send the pings.
+		s.write(PONG, map[string]interface{}{
+			"raw": packet[1:],
+		})
+	case CLOSE.String():
+		s.close("transport close")
+	}
+}
+
+func (s *Session) receiveBinary(data []byte) {
+	s.RLock()
+	onBinary := s.onBinary
+	s.RUnlock()
+	if onBinary != nil {
+		onBinary(data)
+	}
+}
+
+// heartbeat pings the client every ping interval and closes the session when
+// it stays silent past its deadline.
+func (s *Session) heartbeat(now time.Time) {
+	s.Lock()
+	if !s.deadline.IsZero() && now.After(s.deadline) {
+		s.Unlock()
+		s.close("ping timeout")
+		return
+	}
+	ping := s.eio != 3 && !now.Before(s.nextPing)
+	if ping {
+		s.nextPing = now.Add(s.server.config.PingInterval)
+		if s.deadline.IsZero() {
+			s.deadline = now.Add(s.server.config.PingTimeout)
+		}
+	}
+	s.Unlock()
+	if ping && s.Ping() != nil {
+		s.close("transport close")
+	}
+}
+
+// upgrade moves the session to the websocket once the client sent the
+// UPGRADE packet, writing there what the poller did not fetch.
+func (s *Session) upgrade(ws wsConn) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.Lock()
+	s.ws = ws
+	polling := s.polling
+	s.Unlock()
+	if polling == nil {
+		return
+	}
+	for _, packet := range polling.drain() {
+		messageType, data := gWebsocket.TextMessage, []byte(packet.Data)
+		if packet.Binary != nil {
+			messageType, data = gWebsocket.BinaryMessage, packet.Binary
+			if s.eio == 3 {
+				data = append([]byte{byte(MESSAGE)}, data...)
+			}
+		}
+		if s.writeWebsocket(ws, messageType, data, true) != nil {
+			return
+		}
+	}
+}
+
+type sessions struct {
+	sync.RWMutex
+	list map[string]*Session
+}
+
+func (l *sessions) set(session *Session) {
+	l.Lock()
+	defer l.Unlock()
+	l.list[session.id] = session
+}
+
+func (l *sessions) get(id string) *Session {
+	l.RLock()
+	defer l.RUnlock()
+	return l.list[id]
+}
+
+func (l *sessions) all() []*Session {
+	l.RLock()
+	defer l.RUnlock()
+	ret := make([]*Session, 0, len(l.list))
+	for _, session := range l.list {
+		ret = append(ret, session)
+	}
+	return ret
+}
+
+func (l *sessions) delete(id string) {
+	l.Lock()
+	defer l.Unlock()
+	delete(l.list, id)
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
@@ -13,18 +14,16 @@ import (
 )
 
 func socketIoHandle(io *socketio.Io) {
-	users := &userStore{data: make(map[string]string)}
+	adminNps := io.Of("/admin")
 
-	io.OnAuthentication(func(params map[string]string) bool {
-		token, ok := params["token"]
-		if !ok || token != "123" {
-			return false
+	adminNps.OnAuthenticate(func(ctx context.Context, socket *socketio.Socket, auth map[string]interface{}) (interface{}, error) {
+		token, _ := auth["token"].(string)
+		if token != "123" {
+			return nil, &socketio.UseError{Message: "Not authenticated"}
 		}
-		return true
+		return token, nil
 	})
 
-	adminNps := io.Of("/admin")
-
 	adminNps.OnConnection(func(socket *socketio.Socket) {
 		log.Printf("[%s] Người dùng mới kết nối: %s",
 			time.Now().Format("15:04:05"), socket.Id)
@@ -39,13 +38,14 @@ func socketIoHandle(io *socketio.Io) {
 				return
 			}
 
-			users.set(socket.Id, username)
+			socket.Data.Set("username", username)
 			log.Printf("%s đã tham gia phòng chat", username)
 
+			users := usernames(adminNps)
 			adminNps.Emit("user-joined", map[string]interface{}{
 				"message":   fmt.Sprintf("%s đã tham gia phòng chat", username),
-				"users":     users.list(),
-				"userCount": users.count(),
+				"users":     users,
+				"userCount": len(users),
 			})
 		})
 
@@ -59,7 +59,7 @@ func socketIoHandle(io *socketio.Io) {
 				return
 			}
 			text, _ := payload["text"].(string)
-			username := users.get(socket.Id)
+			username, _ := socketio.GetData[string](socket, "username")
 			ts := time.Now().Format("15:04:05")
 
 			log.Printf("[%s] %s: %s", ts, username, text)
@@ -73,28 +73,30 @@ func socketIoHandle(io *socketio.Io) {
 
 		// Sự kiện đang gõ
 		socket.On("typing", func(event *socketio.EventPayload) {
+			username, _ := socketio.GetData[string](socket, "username")
 			socket.Broadcast().Emit("user-typing", map[string]interface{}{
-				"username": users.get(socket.Id),
+				"username": username,
 			})
 		})
 
 		// Sự kiện ngừng gõ
 		socket.On("stop-typing", func(event *socketio.EventPayload) {
+			username, _ := socketio.GetData[string](socket, "username")
 			socket.Broadcast().Emit("user-stopped-typing", map[string]interface{}{
-				"username": users.get(socket.Id),
+				"username": username,
 			})
 		})
 
 		// Sự kiện ngắt kết nối
 		socket.On("disconnect", func(event *socketio.EventPayload) {
-			username := users.get(socket.Id)
-			users.delete(socket.Id)
+			username, _ := socketio.GetData[string](socket, "username")
 			log.Printf("Disconnect %s đã ngắt kết nối", username)
 
+			users := usernames(adminNps)
 			adminNps.Emit("user-left", map[string]interface{}{
 				"message":   fmt.Sprintf("%s đã rời khỏi phòng chat", username),
-				"users":     users.list(),
-				"userCount": users.count(),
+				"users":     users,
+				"userCount": len(users),
 			})
 		})
 	})
@@ -0,0 +1,14 @@
+package main
+
+import "github.com/doquangtan/socketio/v4"
+
+// usernames trả về tên của những người dùng đã tham gia phòng chat
+func usernames(nps *socketio.Namespace) []string {
+	names := []string{}
+	for _, socket := range nps.FetchSockets() {
+		if name, ok := socket.Data["username"].(string); ok {
+			names = append(names, name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,82 @@
+package socketio
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+)
+
+const forwardedHeader = "X-Socketio-Forwarded"
+
+// forwarder routes the requests of a session to the node that owns it, so
+// that polling works without sticky sessions. The owner is encoded in the
+// session id as "<node>.<uuid>", hence node ids must not contain a dot.
+type forwarder struct {
+	node    string
+	proxies map[string]*httputil.ReverseProxy
+}
+
+func newForwarder(node string, peers map[string]string) (*forwarder, error) {
+	if node == "" || strings.Contains(node, ".") {
+		return nil, fmt.Errorf("socketio: invalid node id %q", node)
+	}
+	f := &forwarder{
+		node:    node,
+		proxies: make(map[string]*httputil.ReverseProxy),
+	}
+	for peer, rawUrl := range peers {
+		if peer == "" || strings.Contains(peer, ".") {
+			return nil, fmt.Errorf("socketio: invalid node id %q", peer)
+		}
+		target, err := url.Parse(rawUrl)
+		if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+			return nil, fmt.Errorf("socketio: invalid URL %q of node %q", rawUrl, peer)
+		}
+		if peer == node {
+			continue
+		}
+		proxy := httputil.NewSingleHostReverseProxy(target)
+		// Long-polling responses must reach the client as soon as written.
+		proxy.FlushInterval = -1
+		director := proxy.Director
+		proxy.Director = func(r *http.Request) {
+			director(r)
+			r.Header.Set(forwardedHeader, node)
+		}
+		f.proxies[peer] = proxy
+	}
+	return f, nil
+}
+
+func (f *forwarder) sid(id string) string {
+	return f.node + "." + id
+}
+
+// proxy returns the proxy to the owner of the session, nil when the session
+// is local or the request was already forwarded once.
+func (f *forwarder) proxy(r *http.Request) *httputil.ReverseProxy {
+	if r.Header.Get(forwardedHeader) != "" {
+		return nil
+	}
+	node, _, ok := strings.Cut(r.URL.Query().Get("sid"), ".")
+	if !ok || node == f.node {
+		return nil
+	}
+	return f.proxies[node]
+}
+
+// forward serves the request by forwarding it to the owner of its session
+// and reports whether it did.
+func (s *Io) forward(w http.ResponseWriter, r *http.Request) bool {
+	if s.forwarder == nil {
+		return false
+	}
+	proxy := s.forwarder.proxy(r)
+	if proxy == nil {
+		return false
+	}
+	proxy.ServeHTTP(w, r)
+	return true
+}
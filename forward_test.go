@@ -0,0 +1,104 @@
+package socketio
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPollingForwardingValidation(t *testing.T) {
+	tests := []struct {
+		name  string
+		node  string
+		peers map[string]string
+	}{
+		{"empty node", "", nil},
+		{"dot in node", "node.a", nil},
+		{"dot in peer", "a", map[string]string{"node.b": "http://10.0.0.2:3000"}},
+		{"unparsable URL", "a", map[string]string{"b": "http://10.0.0.2:port"}},
+		{"relative URL", "a", map[string]string{"b": "10.0.0.2:3000"}},
+		{"scheme", "a", map[string]string{"b": "ws://10.0.0.2:3000"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := newForwarder(test.node, test.peers); err == nil {
+				t.Fatal("accepted")
+			}
+			defer func() {
+				if recover() == nil {
+					t.Error("New accepted the option")
+				}
+			}()
+			New(WithPollingForwarding(test.node, test.peers))
+		})
+	}
+}
+
+// forwardingNode starts srv with an Io forwarding to the other nodes of peers.
+func forwardingNode(t *testing.T, node string, srv *httptest.Server, peers map[string]string) *Io {
+	io := New(WithPollingForwarding(node, peers))
+	srv.Config.Handler = io
+	srv.Start()
+	t.Cleanup(func() {
+		srv.Close()
+		io.Close()
+	})
+	return io
+}
+
+func poll(t *testing.T, method string, url string, body string) string {
+	t.Helper()
+	req, _ := http.NewRequest(method, url, strings.NewReader(body))
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	data, _ := io.ReadAll(res.Body)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("%s %s: %d %s", method, url, res.StatusCode, data)
+	}
+	return string(data)
+}
+
+func TestPollingForwarding(t *testing.T) {
+	srvA, srvB := httptest.NewUnstartedServer(nil), httptest.NewUnstartedServer(nil)
+	peers := map[string]string{
+		"a": "http://" + srvA.Listener.Addr().String(),
+		"b": "http://" + srvB.Listener.Addr().String(),
+	}
+	ioA := forwardingNode(t, "a", srvA, peers)
+	ioB := forwardingNode(t, "b", srvB, peers)
+	connected := make(chan string, 2)
+	ioA.OnConnection(func(socket *Socket) { connected <- "a" })
+	ioB.OnConnection(func(socket *Socket) { connected <- "b" })
+
+	open := poll(t, http.MethodGet, srvA.URL+"/socket.io/?EIO=4&transport=polling", "")
+	var handshake struct {
+		SID string `json:"sid"`
+	}
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(open, "0")), &handshake); err != nil {
+		t.Fatalf("open packet %q: %v", open, err)
+	}
+	if !strings.HasPrefix(handshake.SID, "a.") {
+		t.Fatalf("sid %q of node a", handshake.SID)
+	}
+
+	// Both requests land on node b, which does not know the session.
+	url := srvB.URL + "/socket.io/?EIO=4&transport=polling&sid=" + handshake.SID
+	if got := poll(t, http.MethodPost, url, "40"); got != "ok" {
+		t.Fatalf("POST answered %q", got)
+	}
+	if got := poll(t, http.MethodGet, url, ""); !strings.HasPrefix(got, `40{"sid":`) {
+		t.Fatalf("poll answered %q, want the CONNECT of node a", got)
+	}
+	if node := <-connected; node != "a" {
+		t.Errorf("connected on node %s", node)
+	}
+	if n := len(ioB.Sockets()); n != 0 {
+		t.Errorf("%d sockets on node b", n)
+	}
+}
@@ -0,0 +1,78 @@
+package socketio
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	gWebsocket "github.com/gorilla/websocket"
+)
+
+func newTestServer(t testing.TB, opts ...Option) (*Io, *httptest.Server) {
+	io := New(opts...)
+	srv := httptest.NewServer(io)
+	t.Cleanup(func() {
+		srv.Close()
+		io.Close()
+	})
+	return io, srv
+}
+
+// testClient speaks Engine.IO v4 over websocket.
+type testClient struct {
+	t    testing.TB
+	conn *gWebsocket.Conn
+}
+
+func dialTest(t testing.TB, srv *httptest.Server) *testClient {
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/socket.io/?EIO=4&transport=websocket"
+	conn, _, err := gWebsocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	c := &testClient{t: t, conn: conn}
+	if open := c.read(); !strings.HasPrefix(open, "0{") {
+		t.Fatalf("open packet = %q", open)
+	}
+	return c
+}
+
+// connect joins the namespace nsp and returns the CONNECT answer.
+func (c *testClient) connect(nsp string) string {
+	if nsp == "/" {
+		c.send("40")
+	} else {
+		c.send("40" + nsp + ",")
+	}
+	return c.read()
+}
+
+func (c *testClient) send(packet string) {
+	if err := c.conn.WriteMessage(gWebsocket.TextMessage, []byte(packet)); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// read returns the next text message, skipping the pings of the server and
+// the newline that ends the JSON of the packets.
+func (c *testClient) read() string {
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		messageType, m, err := c.conn.ReadMessage()
+		if err != nil {
+			c.t.Fatal(err)
+		}
+		if messageType == gWebsocket.TextMessage && string(m) != "2" {
+			return strings.TrimSuffix(string(m), "\n")
+		}
+	}
+}
+
+// closed reports whether the server closed the connection.
+func (c *testClient) closed() bool {
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, _, err := c.conn.ReadMessage()
+	return err != nil
+}
@@ -1,6 +1,9 @@
 package socketio
 
-import "sync"
+import (
+	"context"
+	"sync"
+)
 
 type AckCallback func(data ...interface{})
 
@@ -11,6 +14,16 @@ type EventPayload struct {
 	Error  error
 	Data   []interface{}
 	Ack    AckCallback
+	ctx    context.Context
+}
+
+// Context returns the handler context. It is cancelled when the socket
+// disconnects or the namespace handler timeout expires.
+func (e *EventPayload) Context() context.Context {
+	if e.ctx == nil {
+		return context.Background()
+	}
+	return e.ctx
 }
 
 type eventCallback func(data *EventPayload)
@@ -0,0 +1,192 @@
+package jwt
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	jwtlib "github.com/golang-jwt/jwt/v5"
+)
+
+var ErrKeyNotFound = errors.New("key not found in JWKS")
+
+// refreshInterval limits how often an unknown "kid" triggers a refetch.
+const refreshInterval = 30 * time.Second
+
+// JWKS is a JSON Web Key Set loaded from a file or an HTTP endpoint. Keys
+// are cached for the TTL and refetched early when a token names an unknown
+// key id.
+type JWKS struct {
+	mu      sync.RWMutex
+	load    func(ctx context.Context) ([]byte, error)
+	ttl     time.Duration
+	keys    map[string]interface{}
+	fetched time.Time
+}
+
+// NewJWKSFromFile reads the key set once from a local file.
+func NewJWKSFromFile(path string) (*JWKS, error) {
+	k := &JWKS{
+		load: func(ctx context.Context) ([]byte, error) {
+			return os.ReadFile(path)
+		},
+	}
+	if err := k.refresh(context.Background()); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// NewJWKSFromURL fetches the key set lazily from url and caches it for ttl.
+func NewJWKSFromURL(url string, ttl time.Duration) *JWKS {
+	return &JWKS{
+		ttl: ttl,
+		load: func(ctx context.Context) ([]byte, error) {
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+			if err != nil {
+				return nil, err
+			}
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				return nil, err
+			}
+			defer res.Body.Close()
+			if res.StatusCode != http.StatusOK {
+				return nil, fmt.Errorf("jwks: unexpected status %d", res.StatusCode)
+			}
+			return io.ReadAll(res.Body)
+		},
+	}
+}
+
+// Key resolves the verification key of token by its "kid" header.
+func (k *JWKS) Key(ctx context.Context, token *jwtlib.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	k.mu.RLock()
+	key, ok := k.keys[kid]
+	fetched := k.fetched
+	k.mu.RUnlock()
+
+	stale := k.ttl > 0 && time.Since(fetched) > k.ttl
+	unknown := !ok && time.Since(fetched) > refreshInterval
+	if fetched.IsZero() || stale || unknown {
+		if err := k.refresh(ctx); err != nil && !ok {
+			return nil, err
+		}
+		k.mu.RLock()
+		key, ok = k.keys[kid]
+		k.mu.RUnlock()
+	}
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	return key, nil
+}
+
+func (k *JWKS) refresh(ctx context.Context) error {
+	data, err := k.load(ctx)
+	if err != nil {
+		return err
+	}
+	keys, err := parseJWKS(data)
+	if err != nil {
+		return err
+	}
+	k.mu.Lock()
+	k.keys = keys
+	k.fetched = time.Now()
+	k.mu.Unlock()
+	return nil
+}
+
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+func parseJWKS(data []byte) (map[string]interface{}, error) {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]interface{})
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("jwks: key %q: %w", jwk.Kid, err)
+		}
+		keys[jwk.Kid] = key
+	}
+	return keys, nil
+}
+
+func (jwk jsonWebKey) publicKey() (interface{}, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decodeBigInt(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+		x, err := decodeBigInt(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "oct":
+		return base64.RawURLEncoding.DecodeString(jwk.K)
+	}
+	return nil, fmt.Errorf("unsupported key type %q", jwk.Kty)
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(data), nil
+}
@@ -0,0 +1,207 @@
+package jwt
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/doquangtan/socketio/v4/engineio"
+	jwtlib "github.com/golang-jwt/jwt/v5"
+)
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func rsaJWK(kid string, key *rsa.PublicKey) map[string]string {
+	return map[string]string{
+		"kid": kid,
+		"kty": "RSA",
+		"use": "sig",
+		"n":   b64(key.N.Bytes()),
+		"e":   b64(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+func ecJWK(kid string, key *ecdsa.PublicKey) map[string]string {
+	return map[string]string{
+		"kid": kid,
+		"kty": "EC",
+		"crv": key.Curve.Params().Name,
+		"x":   b64(key.X.Bytes()),
+		"y":   b64(key.Y.Bytes()),
+	}
+}
+
+func keySet(t testing.TB, keys ...map[string]string) []byte {
+	data, err := json.Marshal(map[string]interface{}{"keys": keys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestParseJWKS(t *testing.T) {
+	ec384 := mustEC(elliptic.P384())
+	keys, err := parseJWKS(keySet(t,
+		rsaJWK("rsa", &rsKey.PublicKey),
+		ecJWK("ec256", &esKey.PublicKey),
+		ecJWK("ec384", &ec384.PublicKey),
+		map[string]string{"kid": "oct", "kty": "oct", "k": b64(hsKey)},
+		map[string]string{"kid": "enc", "kty": "RSA", "use": "enc", "n": "!", "e": "!"},
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key, ok := keys["rsa"].(*rsa.PublicKey); !ok || !key.Equal(&rsKey.PublicKey) {
+		t.Errorf("RSA key %v", keys["rsa"])
+	}
+	if key, ok := keys["ec256"].(*ecdsa.PublicKey); !ok || !key.Equal(&esKey.PublicKey) {
+		t.Errorf("P-256 key %v", keys["ec256"])
+	}
+	if key, ok := keys["ec384"].(*ecdsa.PublicKey); !ok || !key.Equal(&ec384.PublicKey) {
+		t.Errorf("P-384 key %v", keys["ec384"])
+	}
+	if key, ok := keys["oct"].([]byte); !ok || string(key) != string(hsKey) {
+		t.Errorf("oct key %v", keys["oct"])
+	}
+	if _, ok := keys["enc"]; ok {
+		t.Error("encryption key kept")
+	}
+
+	for name, jwk := range map[string]map[string]string{
+		"key type": {"kid": "x", "kty": "OKP"},
+		"curve":    {"kid": "x", "kty": "EC", "crv": "P-192"},
+		"encoding": {"kid": "x", "kty": "RSA", "n": "!", "e": "AQAB"},
+	} {
+		if _, err := parseJWKS(keySet(t, jwk)); err == nil {
+			t.Errorf("unsupported %s accepted", name)
+		}
+	}
+}
+
+func TestJWKSFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, keySet(t, rsaJWK("1", &rsKey.PublicKey)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	jwks, err := NewJWKSFromFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := Config{JWKS: jwks}
+	raw := sign(t, jwtlib.SigningMethodRS256, rsKey, jwtlib.MapClaims{"sub": "user-1"}, "1")
+	if _, _, err := authenticate(config, engineio.Handshake{}, map[string]interface{}{"token": raw}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A rotated key is read once the refresh interval has passed.
+	if err := os.WriteFile(path, keySet(t, rsaJWK("1", &rsKey.PublicKey), ecJWK("2", &esKey.PublicKey)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	raw = sign(t, jwtlib.SigningMethodES256, esKey, jwtlib.MapClaims{"sub": "user-1"}, "2")
+	if _, _, err := authenticate(config, engineio.Handshake{}, map[string]interface{}{"token": raw}); !invalidToken(err) {
+		t.Fatalf("error = %v, want invalid token before the refresh interval", err)
+	}
+	jwks.fetched = time.Now().Add(-refreshInterval - time.Second)
+	if _, _, err := authenticate(config, engineio.Handshake{}, map[string]interface{}{"token": raw}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewJWKSFromFile(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("missing file accepted")
+	}
+}
+
+// jwksServer serves the key set in keys, counting the requests.
+type jwksServer struct {
+	mu       sync.Mutex
+	keys     []byte
+	status   int
+	requests atomic.Int32
+}
+
+func (s *jwksServer) set(keys []byte, status int) {
+	s.mu.Lock()
+	s.keys, s.status = keys, status
+	s.mu.Unlock()
+}
+
+func (s *jwksServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.requests.Add(1)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w.WriteHeader(s.status)
+	w.Write(s.keys)
+}
+
+func TestJWKSFromURL(t *testing.T) {
+	server := &jwksServer{}
+	server.set(keySet(t, rsaJWK("1", &rsKey.PublicKey)), http.StatusOK)
+	srv := httptest.NewServer(server)
+	t.Cleanup(srv.Close)
+	jwks := NewJWKSFromURL(srv.URL, time.Minute)
+	ctx := context.Background()
+	token := func(kid string) *jwtlib.Token {
+		return &jwtlib.Token{Header: map[string]interface{}{"kid": kid}}
+	}
+	expect := func(kid string, found bool, requests int32) {
+		t.Helper()
+		_, err := jwks.Key(ctx, token(kid))
+		if found && err != nil {
+			t.Fatalf("key %q: %v", kid, err)
+		}
+		if !found && err == nil {
+			t.Fatalf("key %q found", kid)
+		}
+		if n := server.requests.Load(); n != requests {
+			t.Fatalf("%d requests, want %d", n, requests)
+		}
+	}
+
+	if server.requests.Load() != 0 {
+		t.Fatal("fetched before the first token")
+	}
+	expect("1", true, 1)
+	expect("1", true, 1)
+
+	// An unknown key id is refetched at most once per refresh interval.
+	server.set(keySet(t, rsaJWK("1", &rsKey.PublicKey), ecJWK("2", &esKey.PublicKey)), http.StatusOK)
+	expect("2", false, 1)
+	jwks.fetched = time.Now().Add(-refreshInterval - time.Second)
+	expect("2", true, 2)
+	expect("3", false, 2)
+
+	// Keys are refetched once stale, and kept while the endpoint fails.
+	server.set(nil, http.StatusInternalServerError)
+	jwks.fetched = time.Now().Add(-2 * time.Minute)
+	expect("2", true, 3)
+	server.set(keySet(t, ecJWK("2", &esKey.PublicKey)), http.StatusOK)
+	expect("2", true, 4)
+	jwks.fetched = time.Now().Add(-2 * time.Minute)
+	expect("1", false, 5)
+}
+
+func TestJWKSFromURLError(t *testing.T) {
+	server := &jwksServer{}
+	server.set([]byte("not found"), http.StatusNotFound)
+	srv := httptest.NewServer(server)
+	t.Cleanup(srv.Close)
+	_, err := NewJWKSFromURL(srv.URL, time.Minute).Key(context.Background(), &jwtlib.Token{Header: map[string]interface{}{"kid": "1"}})
+	if err == nil || errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("error = %v, want the status", err)
+	}
+}
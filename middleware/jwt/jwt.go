@@ -0,0 +1,156 @@
+// Package jwt authenticates Socket.IO connections with JSON Web Tokens.
+//
+//	io.Of("/").OnAuthenticate(jwt.New(jwt.Config{
+//		Key: []byte("secret"),
+//	}))
+//
+// The verified claims become the socket principal, and the socket leaves the
+// namespace with reason "token expired" once the token expires. The other
+// namespaces of the connection are not affected.
+package jwt
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/doquangtan/socketio/v4"
+	jwtlib "github.com/golang-jwt/jwt/v5"
+)
+
+const ExpiredReason = "token expired"
+
+var (
+	ErrTokenMissing = errors.New("token missing")
+	ErrNoKey        = errors.New("no verification key configured")
+)
+
+type Config struct {
+	// Key verifies the signature: []byte for HS*, *rsa.PublicKey for RS* and
+	// *ecdsa.PublicKey for ES* tokens. Ignored when JWKS is set.
+	Key interface{}
+
+	// JWKS resolves the verification key from the "kid" token header.
+	JWKS *JWKS
+
+	// Algorithms restricts the accepted "alg" values,
+	// by default HS256/384/512, RS256/384/512 and ES256/384/512.
+	Algorithms []string
+
+	// AuthKey is the field of the CONNECT auth payload, "token" by default.
+	AuthKey string
+
+	// QueryKey is the query parameter of the handshake, "token" by default.
+	QueryKey string
+
+	// CookieName is the cookie of the handshake, "token" by default.
+	CookieName string
+
+	// Leeway tolerates clock skew when checking exp, nbf and iat.
+	Leeway time.Duration
+
+	// UserClaim is the claim passed to Socket.SetUserID, "sub" by default.
+	UserClaim string
+}
+
+var defaultAlgorithms = []string{
+	"HS256", "HS384", "HS512",
+	"RS256", "RS384", "RS512",
+	"ES256", "ES384", "ES512",
+}
+
+// New returns an OnAuthenticate handler. The token is looked up in the auth
+// payload, then the Authorization header, the query string and the cookie.
+func New(config Config) socketio.AuthenticateFunc {
+	if config.AuthKey == "" {
+		config.AuthKey = "token"
+	}
+	if config.QueryKey == "" {
+		config.QueryKey = "token"
+	}
+	if config.CookieName == "" {
+		config.CookieName = "token"
+	}
+	if config.UserClaim == "" {
+		config.UserClaim = "sub"
+	}
+	if len(config.Algorithms) == 0 {
+		config.Algorithms = defaultAlgorithms
+	}
+	parser := jwtlib.NewParser(
+		jwtlib.WithValidMethods(config.Algorithms),
+		jwtlib.WithLeeway(config.Leeway),
+	)
+
+	return func(ctx context.Context, socket *socketio.Socket, auth map[string]interface{}) (interface{}, error) {
+		raw := config.lookup(socket, auth)
+		if raw == "" {
+			return nil, &socketio.UseError{Message: ErrTokenMissing.Error()}
+		}
+
+		claims := jwtlib.MapClaims{}
+		_, err := parser.ParseWithClaims(raw, claims, func(token *jwtlib.Token) (interface{}, error) {
+			if config.JWKS != nil {
+				return config.JWKS.Key(ctx, token)
+			}
+			if config.Key == nil {
+				return nil, ErrNoKey
+			}
+			return config.Key, nil
+		})
+		if err != nil {
+			return nil, &socketio.UseError{
+				Message: "invalid token",
+				Data: map[string]interface{}{
+					"reason": err.Error(),
+				},
+			}
+		}
+
+		if userId, ok := claims[config.UserClaim].(string); ok {
+			socket.SetUserID(userId)
+		}
+		if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+			expireOnTime(socket, exp.Add(config.Leeway))
+		}
+		return claims, nil
+	}
+}
+
+// Claims returns the claims verified for the socket.
+func Claims(socket *socketio.Socket) (jwtlib.MapClaims, bool) {
+	claims, ok := socket.Principal().(jwtlib.MapClaims)
+	return claims, ok
+}
+
+func (config Config) lookup(socket *socketio.Socket, auth map[string]interface{}) string {
+	if token, ok := auth[config.AuthKey].(string); ok && token != "" {
+		return strings.TrimPrefix(token, "Bearer ")
+	}
+	handshake := socket.Handshake
+	if value := handshake.Headers.Get("Authorization"); value != "" {
+		if scheme, token, ok := strings.Cut(value, " "); ok && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+	}
+	if token := handshake.Query.Get(config.QueryKey); token != "" {
+		return token
+	}
+	request := http.Request{Header: handshake.Headers}
+	if cookie, err := request.Cookie(config.CookieName); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+func expireOnTime(socket *socketio.Socket, expiresAt time.Time) {
+	timer := time.AfterFunc(time.Until(expiresAt), func() {
+		socket.DisconnectNamespace(ExpiredReason)
+	})
+	go func() {
+		<-socket.Context().Done()
+		timer.Stop()
+	}()
+}
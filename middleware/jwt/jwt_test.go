@@ -0,0 +1,335 @@
+package jwt
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/doquangtan/socketio/v4"
+	"github.com/doquangtan/socketio/v4/engineio"
+	jwtlib "github.com/golang-jwt/jwt/v5"
+	gWebsocket "github.com/gorilla/websocket"
+)
+
+var (
+	hsKey = []byte("secret")
+	rsKey = mustRSA()
+	esKey = mustEC(elliptic.P256())
+)
+
+func mustRSA() *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
+
+func mustEC(curve elliptic.Curve) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
+
+func sign(t testing.TB, method jwtlib.SigningMethod, key interface{}, claims jwtlib.MapClaims, kid string) string {
+	t.Helper()
+	token := jwtlib.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	raw, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+// authenticate runs the handler of config for a socket without connection.
+func authenticate(config Config, handshake engineio.Handshake, auth map[string]interface{}) (*socketio.Socket, interface{}, error) {
+	socket := &socketio.Socket{Handshake: handshake}
+	principal, err := New(config)(context.Background(), socket, auth)
+	return socket, principal, err
+}
+
+func invalidToken(err error) bool {
+	var useErr *socketio.UseError
+	return errors.As(err, &useErr) && useErr.Message == "invalid token"
+}
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name   string
+		method jwtlib.SigningMethod
+		sign   interface{}
+		verify interface{}
+		ok     bool
+	}{
+		{"HS256", jwtlib.SigningMethodHS256, hsKey, hsKey, true},
+		{"HS512", jwtlib.SigningMethodHS512, hsKey, hsKey, true},
+		{"HS256 wrong key", jwtlib.SigningMethodHS256, []byte("other"), hsKey, false},
+		{"RS256", jwtlib.SigningMethodRS256, rsKey, &rsKey.PublicKey, true},
+		{"RS384", jwtlib.SigningMethodRS384, rsKey, &rsKey.PublicKey, true},
+		{"RS256 wrong key", jwtlib.SigningMethodRS256, mustRSA(), &rsKey.PublicKey, false},
+		{"ES256", jwtlib.SigningMethodES256, esKey, &esKey.PublicKey, true},
+		{"ES384", jwtlib.SigningMethodES384, mustEC(elliptic.P384()), nil, true},
+		{"ES256 wrong key", jwtlib.SigningMethodES256, mustEC(elliptic.P256()), &esKey.PublicKey, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			verify := test.verify
+			if verify == nil {
+				verify = &test.sign.(*ecdsa.PrivateKey).PublicKey
+			}
+			raw := sign(t, test.method, test.sign, jwtlib.MapClaims{"sub": "user-1"}, "")
+			socket, principal, err := authenticate(Config{Key: verify}, engineio.Handshake{}, map[string]interface{}{"token": raw})
+			if !test.ok {
+				if !invalidToken(err) {
+					t.Fatalf("error = %v, want invalid token", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claims, ok := principal.(jwtlib.MapClaims); !ok || claims["sub"] != "user-1" {
+				t.Errorf("principal %v", principal)
+			}
+			if socket.UserID() != "user-1" {
+				t.Errorf("user id %q", socket.UserID())
+			}
+		})
+	}
+}
+
+func TestVerifyClaims(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims jwtlib.MapClaims
+		leeway time.Duration
+		ok     bool
+	}{
+		{"expired", jwtlib.MapClaims{"exp": time.Now().Add(-time.Minute).Unix()}, 0, false},
+		{"expired within leeway", jwtlib.MapClaims{"exp": time.Now().Add(-time.Minute).Unix()}, 2 * time.Minute, true},
+		{"not yet valid", jwtlib.MapClaims{"nbf": time.Now().Add(time.Minute).Unix()}, 0, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			raw := sign(t, jwtlib.SigningMethodHS256, hsKey, test.claims, "")
+			_, _, err := authenticate(Config{Key: hsKey, Leeway: test.leeway}, engineio.Handshake{}, map[string]interface{}{"token": raw})
+			if test.ok != (err == nil) {
+				t.Errorf("error = %v", err)
+			}
+		})
+	}
+}
+
+func TestAlgorithms(t *testing.T) {
+	claims := jwtlib.MapClaims{"sub": "user-1"}
+	none := sign(t, jwtlib.SigningMethodNone, jwtlib.UnsafeAllowNoneSignatureType, claims, "")
+	// Algorithm confusion: the public RSA key, known to anyone, used as the
+	// secret of an HMAC token.
+	der, err := x509.MarshalPKIXPublicKey(&rsKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	jwks := &JWKS{keys: map[string]interface{}{"rsa": &rsKey.PublicKey}, fetched: time.Now()}
+
+	tests := []struct {
+		name   string
+		config Config
+		token  string
+		ok     bool
+	}{
+		{"none", Config{Key: hsKey}, none, false},
+		{"none allowed", Config{Key: hsKey, Algorithms: []string{"none"}}, none, false},
+		{"HS256 with the public key as secret", Config{Key: &rsKey.PublicKey}, sign(t, jwtlib.SigningMethodHS256, publicPEM, claims, ""), false},
+		{"HS256 with the DER public key as secret", Config{Key: &rsKey.PublicKey}, sign(t, jwtlib.SigningMethodHS256, der, claims, ""), false},
+		{"HS256 with the public key of the JWKS", Config{JWKS: jwks}, sign(t, jwtlib.SigningMethodHS256, publicPEM, claims, "rsa"), false},
+		{"RS256 of the JWKS", Config{JWKS: jwks}, sign(t, jwtlib.SigningMethodRS256, rsKey, claims, "rsa"), true},
+		{"HS256 restricted to RS256", Config{Key: hsKey, Algorithms: []string{"RS256"}}, sign(t, jwtlib.SigningMethodHS256, hsKey, claims, ""), false},
+		{"RS384 restricted to RS256", Config{Key: &rsKey.PublicKey, Algorithms: []string{"RS256"}}, sign(t, jwtlib.SigningMethodRS384, rsKey, claims, ""), false},
+		{"RS256 restricted to RS256", Config{Key: &rsKey.PublicKey, Algorithms: []string{"RS256"}}, sign(t, jwtlib.SigningMethodRS256, rsKey, claims, ""), true},
+		{"PS256 by default", Config{Key: &rsKey.PublicKey}, sign(t, jwtlib.SigningMethodPS256, rsKey, claims, ""), false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, _, err := authenticate(test.config, engineio.Handshake{}, map[string]interface{}{"token": test.token})
+			if test.ok && err != nil {
+				t.Fatal(err)
+			}
+			if !test.ok && !invalidToken(err) {
+				t.Fatalf("error = %v, want invalid token", err)
+			}
+		})
+	}
+}
+
+func TestNoKey(t *testing.T) {
+	raw := sign(t, jwtlib.SigningMethodHS256, hsKey, jwtlib.MapClaims{}, "")
+	_, _, err := authenticate(Config{}, engineio.Handshake{}, map[string]interface{}{"token": raw})
+	var useErr *socketio.UseError
+	if !errors.As(err, &useErr) || !strings.Contains(useErr.Data["reason"].(string), ErrNoKey.Error()) {
+		t.Fatalf("error = %v, want %v", err, ErrNoKey)
+	}
+}
+
+func TestLookupOrder(t *testing.T) {
+	token := func(user string) string {
+		return sign(t, jwtlib.SigningMethodHS256, hsKey, jwtlib.MapClaims{"sub": user}, "")
+	}
+	handshake := func(header, query, cookie bool) engineio.Handshake {
+		h := engineio.Handshake{Headers: http.Header{}, Query: url.Values{}}
+		if header {
+			h.Headers.Set("Authorization", "Bearer "+token("header"))
+		}
+		if query {
+			h.Query.Set("token", token("query"))
+		}
+		if cookie {
+			h.Headers.Set("Cookie", "other=1; token="+token("cookie"))
+		}
+		return h
+	}
+	tests := []struct {
+		name      string
+		auth      map[string]interface{}
+		handshake engineio.Handshake
+		user      string
+	}{
+		{"auth", map[string]interface{}{"token": token("auth")}, handshake(true, true, true), "auth"},
+		{"auth with scheme", map[string]interface{}{"token": "Bearer " + token("auth")}, handshake(true, true, true), "auth"},
+		{"header", map[string]interface{}{"token": ""}, handshake(true, true, true), "header"},
+		{"query", nil, handshake(false, true, true), "query"},
+		{"cookie", nil, handshake(false, false, true), "cookie"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			socket, _, err := authenticate(Config{Key: hsKey}, test.handshake, test.auth)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if socket.UserID() != test.user {
+				t.Errorf("token of %q used, want %q", socket.UserID(), test.user)
+			}
+		})
+	}
+
+	t.Run("basic authorization", func(t *testing.T) {
+		h := engineio.Handshake{Headers: http.Header{"Authorization": {"Basic " + token("header")}}}
+		_, _, err := authenticate(Config{Key: hsKey}, h, nil)
+		var useErr *socketio.UseError
+		if !errors.As(err, &useErr) || useErr.Message != ErrTokenMissing.Error() {
+			t.Fatalf("error = %v, want %v", err, ErrTokenMissing)
+		}
+	})
+
+	t.Run("custom names", func(t *testing.T) {
+		config := Config{Key: hsKey, AuthKey: "jwt", QueryKey: "access_token", CookieName: "session", UserClaim: "email"}
+		raw := sign(t, jwtlib.SigningMethodHS256, hsKey, jwtlib.MapClaims{"email": "a@example.com"}, "")
+		for _, h := range []engineio.Handshake{
+			{Query: url.Values{"access_token": {raw}}},
+			{Headers: http.Header{"Cookie": {"session=" + raw}}},
+		} {
+			socket, _, err := authenticate(config, h, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if socket.UserID() != "a@example.com" {
+				t.Errorf("user id %q", socket.UserID())
+			}
+		}
+	})
+}
+
+// dial connects an Engine.IO v4 websocket client and returns a function
+// reading the next Socket.IO packet, skipping the pings.
+func dial(t *testing.T, srv *httptest.Server) (*gWebsocket.Conn, func() string) {
+	conn, _, err := gWebsocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/socket.io/?EIO=4&transport=websocket", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	read := func() string {
+		for {
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			_, m, err := conn.ReadMessage()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(m) != "2" {
+				return strings.TrimSuffix(string(m), "\n")
+			}
+		}
+	}
+	if open := read(); !strings.HasPrefix(open, "0{") {
+		t.Fatalf("open packet = %q", open)
+	}
+	return conn, read
+}
+
+func TestExpiry(t *testing.T) {
+	io := socketio.New()
+	srv := httptest.NewServer(io)
+	t.Cleanup(func() {
+		srv.Close()
+		io.Close()
+	})
+	io.Of("/private").OnAuthenticate(New(Config{Key: hsKey}))
+	reasons := make(chan string, 1)
+	io.Of("/private").OnConnection(func(socket *socketio.Socket) {
+		socket.On("disconnect", func(event *socketio.EventPayload) {
+			reasons <- event.Data[0].(string)
+		})
+	})
+	io.OnConnection(func(socket *socketio.Socket) {
+		socket.On("ping", func(event *socketio.EventPayload) {
+			event.Ack("pong")
+		})
+	})
+
+	conn, read := dial(t, srv)
+	send := func(packet string) {
+		if err := conn.WriteMessage(gWebsocket.TextMessage, []byte(packet)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	send("40")
+	if got := read(); !strings.HasPrefix(got, "40{") {
+		t.Fatalf("CONNECT / answered %q", got)
+	}
+	raw := sign(t, jwtlib.SigningMethodHS256, hsKey, jwtlib.MapClaims{"sub": "user-1", "exp": time.Now().Add(time.Second).Unix()}, "")
+	send(`40/private,{"token":"` + raw + `"}`)
+	if got := read(); !strings.HasPrefix(got, "40/private,{") {
+		t.Fatalf("CONNECT /private answered %q", got)
+	}
+
+	if got := read(); got != "41/private," {
+		t.Fatalf("packet = %q, want DISCONNECT of /private", got)
+	}
+	if reason := <-reasons; reason != ExpiredReason {
+		t.Errorf("disconnect reason %q, want %q", reason, ExpiredReason)
+	}
+	// Only the namespace of the token is left.
+	send(`421["ping"]`)
+	if got := read(); got != `431["pong"]` {
+		t.Fatalf("packet = %q, want the ack of ping", got)
+	}
+	send("40/private,")
+	if got := read(); !strings.HasPrefix(got, "44/private,{") || !strings.Contains(got, `"message":"token missing"`) {
+		t.Fatalf("CONNECT without token answered %q", got)
+	}
+}
@@ -1,18 +1,34 @@
 package socketio
 
 import (
+	"context"
 	"sync"
+	"time"
+
+	"github.com/doquangtan/socketio/v4/adapter"
 )
 
 type Namespace struct {
+	sync.RWMutex
+	io           *Io
 	Name         string
 	sockets      *connections
 	rooms        *rooms
+	adapter      *Adapter
+	users        *users
 	onConnection connectionEvent
+	serverSide   listeners
+
+	handlerTimeout time.Duration
+	authenticateFn AuthenticateFunc
+	authTimeout    time.Duration
+	presence       *Presence
+	parent         *ParentNamespace
 }
 
-func newNamespace(name string) *Namespace {
-	return &Namespace{
+func newNamespace(io *Io, name string) *Namespace {
+	nps := &Namespace{
+		io:   io,
 		Name: name,
 		sockets: &connections{
 			conn: make(map[string]*Socket),
@@ -20,34 +36,90 @@ func newNamespace(name string) *Namespace {
 		rooms: &rooms{
 			list: make(map[string]*Room),
 		},
+		users: &users{
+			list: make(map[string]*connections),
+		},
 		onConnection: connectionEvent{
 			list: make(map[string][]connectionEventCallback),
 		},
+		serverSide: listeners{
+			list: make(map[string][]eventCallback),
+		},
 	}
+	nps.rooms.nps = nps
+	nps.adapter = newAdapter(nps)
+	return nps
 }
 
 func (nps *Namespace) OnConnection(fn connectionEventCallback) {
 	nps.onConnection.set("connection", fn)
 }
 
-func (nps *Namespace) Emit(event string, agrs ...interface{}) error {
-	for _, socket := range nps.sockets.all() {
-		socket.Emit(event, agrs...)
+// SetHandlerTimeout bounds the context of every event handler of the
+// namespace. Zero, the default, only cancels it on disconnect.
+func (nps *Namespace) SetHandlerTimeout(timeout time.Duration) {
+	nps.handlerTimeout = timeout
+}
+
+func (nps *Namespace) connectionCallbacks() []connectionEventCallback {
+	ret := nps.onConnection.get("connection")
+	if nps.parent != nil {
+		ret = append(ret, nps.parent.onConnection.get("connection")...)
+	}
+	return ret
+}
+
+func (nps *Namespace) middleware() func(socket *Socket, next func() *UseError) *UseError {
+	if nps.parent != nil {
+		return nps.parent.use
 	}
 	return nil
 }
 
+func (nps *Namespace) authenticator() AuthenticateFunc {
+	if nps.authenticateFn == nil && nps.parent != nil {
+		return nps.parent.authenticateFn
+	}
+	return nps.authenticateFn
+}
+
+func (nps *Namespace) Emit(event string, agrs ...interface{}) error {
+	return nps.operator(adapter.BroadcastOptions{}).Emit(event, agrs...)
+}
+
+func (nps *Namespace) Volatile() *broadcastOperator {
+	return nps.operator(adapter.BroadcastOptions{}).Volatile()
+}
+
+func (nps *Namespace) Compress(compress bool) *broadcastOperator {
+	return nps.operator(adapter.BroadcastOptions{}).Compress(compress)
+}
+
+// Except leaves the sockets with these ids or in these rooms out of the
+// broadcast.
+func (nps *Namespace) Except(rooms ...string) *broadcastOperator {
+	return nps.operator(adapter.BroadcastOptions{Except: rooms})
+}
+
 func (nps *Namespace) socketJoinRoom(room string, socket *Socket) {
-	nps.rooms.create(room).sockets.set(socket)
-	socket.rooms.set(room)
+	nps.adapter.addToRoom(room, socket)
+	if p := nps.Presence(); p != nil {
+		p.join(room, socket)
+	}
 }
 
 func (nps *Namespace) socketLeaveRoom(room string, socket *Socket) {
-	if socket.rooms.delete(room) != -1 {
-		nps.rooms.create(room).sockets.delete(socket.Id)
+	if nps.adapter.removeFromRoom(room, socket) {
+		if p := nps.Presence(); p != nil {
+			p.leave(room, socket)
+		}
 	}
 }
 
+func (nps *Namespace) Adapter() *Adapter {
+	return nps.adapter
+}
+
 func (nps *Namespace) socketLeaveAllRooms(socket *Socket) {
 	for _, room := range socket.rooms.all() {
 		nps.socketLeaveRoom(room, socket)
@@ -62,8 +134,34 @@ func (nps *Namespace) Sockets() []*Socket {
 	return nps.sockets.all()
 }
 
+// FetchSockets returns a snapshot of every socket of the namespace,
+// including its rooms and data. With an adapter the sockets of the other
+// nodes are included.
+func (nps *Namespace) FetchSockets() []RemoteSocket {
+	return nps.operator(adapter.BroadcastOptions{}).FetchSockets()
+}
+
+func (nps *Namespace) FetchSocketsContext(ctx context.Context) ([]RemoteSocket, error) {
+	return nps.operator(adapter.BroadcastOptions{}).FetchSocketsContext(ctx)
+}
+
+// SocketsJoin makes every socket of the namespace, on every node, join the
+// rooms.
+func (nps *Namespace) SocketsJoin(rooms ...string) {
+	nps.operator(adapter.BroadcastOptions{}).SocketsJoin(rooms...)
+}
+
+func (nps *Namespace) SocketsLeave(rooms ...string) {
+	nps.operator(adapter.BroadcastOptions{}).SocketsLeave(rooms...)
+}
+
+func (nps *Namespace) DisconnectSockets() {
+	nps.operator(adapter.BroadcastOptions{}).DisconnectSockets()
+}
+
 type namespaces struct {
 	sync.RWMutex
+	io   *Io
 	list map[string]*Namespace
 }
 
@@ -71,13 +169,31 @@ func (n *namespaces) create(name string) *Namespace {
 	n.Lock()
 	ret, ok := n.list[name]
 	if !ok {
-		ret = newNamespace(name)
+		ret = newNamespace(n.io, name)
 		n.list[name] = ret
 	}
 	n.Unlock()
 	return ret
 }
 
+// add registers nps unless a namespace of that name exists, and returns the
+// registered namespace.
+func (n *namespaces) add(nps *Namespace) *Namespace {
+	n.Lock()
+	defer n.Unlock()
+	if ret, ok := n.list[nps.Name]; ok {
+		return ret
+	}
+	n.list[nps.Name] = nps
+	return nps
+}
+
+func (n *namespaces) delete(name string) {
+	n.Lock()
+	delete(n.list, name)
+	n.Unlock()
+}
+
 // func (n *namespaces) all() []*Namespace {
 // 	n.RLock()
 // 	ret := make([]*Namespace, 0)
@@ -0,0 +1,110 @@
+package socketio
+
+import (
+	"github.com/doquangtan/socketio/v4/adapter"
+	"github.com/doquangtan/socketio/v4/engineio"
+)
+
+// Option configures an Io created by New.
+type Option func(io *Io)
+
+// WithSendQueue sets how many outbound packets may wait for a slow client and
+// what to do once that limit is reached. A capacity of 0 disables the bound.
+// By default the queue is unbounded, as writes were before the queue existed:
+// set a capacity to protect the server from clients that do not keep up.
+func WithSendQueue(capacity int, policy SlowConsumerPolicy) Option {
+	return func(io *Io) {
+		io.sendQueueCapacity = capacity
+		io.slowConsumerPolicy = policy
+	}
+}
+
+// WithDispatch selects how incoming events are dispatched to handlers.
+// workers sizes the pool of DispatchSharded and defaults to GOMAXPROCS.
+func WithDispatch(mode DispatchMode, workers int) Option {
+	return func(io *Io) {
+		io.dispatchMode = mode
+		if workers > 0 {
+			io.dispatchWorkers = workers
+		}
+	}
+}
+
+// WithTrustedProxies lists the proxies, as IPs or CIDR ranges, whose
+// X-Forwarded-For and X-Forwarded-Proto headers are used to fill
+// Handshake.Address and Handshake.Secure. New panics on an entry that is
+// neither.
+func WithTrustedProxies(proxies ...string) Option {
+	return func(io *Io) {
+		io.engineConfig.TrustedProxies = proxies
+	}
+}
+
+// WithAdapter connects the server to the other nodes of a cluster through bus.
+func WithAdapter(bus adapter.Bus) Option {
+	return func(io *Io) {
+		io.bus = bus
+	}
+}
+
+// WithPollingForwarding lets the requests of a polling session land on any
+// node, without sticky sessions. Session ids carry nodeID, and the requests
+// of a session of another node are forwarded to its URL in peers, e.g.
+// {"node-b": "http://10.0.0.2:3000"}. New panics on an empty node id or one
+// containing a dot, and on a peer URL that is not an absolute http or https
+// URL.
+//
+// With Fiber, only polling requests are forwarded: a websocket upgrade landing
+// on another node than the one of its session fails, so the upgrade requests
+// still need sticky sessions, or the clients must start with the websocket
+// transport.
+func WithPollingForwarding(nodeID string, peers map[string]string) Option {
+	return func(io *Io) {
+		forwarder, err := newForwarder(nodeID, peers)
+		if err != nil {
+			panic(err)
+		}
+		io.forwarder = forwarder
+	}
+}
+
+// WithAllowEIO3 accepts the Engine.IO v3 clients of Socket.IO v2, which ping
+// the server themselves and are connected to the root namespace implicitly.
+func WithAllowEIO3() Option {
+	return func(io *Io) {
+		io.engineConfig.AllowEIO3 = true
+	}
+}
+
+// WithJSONP enables the JSONP polling of clients without CORS support: polls
+// with a "j" query parameter are answered with ___eio[j]("...") scripts and
+// their packets are posted as the "d" field of a form.
+func WithJSONP() Option {
+	return func(io *Io) {
+		io.engineConfig.JSONP = true
+	}
+}
+
+// WithPerMessageDeflate compresses the websocket messages of the clients
+// that negotiate permessage-deflate, with both net/http and Fiber.
+func WithPerMessageDeflate(config engineio.PerMessageDeflate) Option {
+	return func(io *Io) {
+		io.engineConfig.PerMessageDeflate = &config
+	}
+}
+
+// WithHTTPCompression compresses the polling responses of the clients that
+// accept gzip, deflate or, when enabled, br.
+func WithHTTPCompression(config engineio.HTTPCompression) Option {
+	return func(io *Io) {
+		io.engineConfig.HTTPCompression = &config
+	}
+}
+
+// WithCookie sets a cookie to the session id, e.g. for the sticky sessions of
+// a load balancer.
+func WithCookie(cookie engineio.Cookie) Option {
+	return func(io *Io) {
+		io.engineConfig.Cookie = &cookie
+	}
+}
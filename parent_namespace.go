@@ -0,0 +1,163 @@
+package socketio
+
+import (
+	"errors"
+	"regexp"
+	"sync"
+)
+
+var ErrorNamespaceMismatch = errors.New("namespace does not match")
+
+// NamespaceMatcher accepts a namespace name, and the auth payload of the
+// CONNECT packet, by returning nil.
+type NamespaceMatcher func(name string, auth map[string]interface{}) error
+
+func MatchRegexp(re *regexp.Regexp) NamespaceMatcher {
+	return func(name string, auth map[string]interface{}) error {
+		if !re.MatchString(name) {
+			return ErrorNamespaceMismatch
+		}
+		return nil
+	}
+}
+
+// ParentNamespace spawns child namespaces on demand for the names accepted
+// by its matcher. Connection handlers, middleware and authentication set on
+// the parent apply to every child.
+type ParentNamespace struct {
+	sync.RWMutex
+	matcher        NamespaceMatcher
+	children       map[string]*Namespace
+	onConnection   connectionEvent
+	use            func(socket *Socket, next func() *UseError) *UseError
+	authenticateFn AuthenticateFunc
+	cleanup        bool
+}
+
+func (s *Io) OfMatcher(match NamespaceMatcher) *ParentNamespace {
+	parent := &ParentNamespace{
+		matcher:  match,
+		children: make(map[string]*Namespace),
+		onConnection: connectionEvent{
+			list: make(map[string][]connectionEventCallback),
+		},
+	}
+	s.parents.Lock()
+	s.parents.list = append(s.parents.list, parent)
+	s.parents.Unlock()
+	return parent
+}
+
+func (p *ParentNamespace) OnConnection(fn connectionEventCallback) {
+	p.onConnection.set("connection", fn)
+}
+
+func (p *ParentNamespace) Use(fn func(socket *Socket, next func() *UseError) *UseError) {
+	p.use = fn
+}
+
+func (p *ParentNamespace) OnAuthenticate(fn AuthenticateFunc) {
+	p.authenticateFn = fn
+}
+
+// CleanupEmptyChildren removes a child namespace once its last socket
+// disconnects.
+func (p *ParentNamespace) CleanupEmptyChildren(cleanup bool) {
+	p.cleanup = cleanup
+}
+
+func (p *ParentNamespace) Children() []*Namespace {
+	p.RLock()
+	defer p.RUnlock()
+	ret := make([]*Namespace, 0, len(p.children))
+	for _, nps := range p.children {
+		ret = append(ret, nps)
+	}
+	return ret
+}
+
+// Emit sends the event to every socket of every child namespace.
+func (p *ParentNamespace) Emit(event string, agrs ...interface{}) error {
+	for _, nps := range p.Children() {
+		if err := nps.Emit(event, agrs...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (nps *Namespace) Parent() *ParentNamespace {
+	return nps.parent
+}
+
+type parentNamespaces struct {
+	sync.RWMutex
+	list []*ParentNamespace
+}
+
+func (p *parentNamespaces) all() []*ParentNamespace {
+	p.RLock()
+	defer p.RUnlock()
+	return append([]*ParentNamespace{}, p.list...)
+}
+
+// lookupNamespace returns the namespace a client may connect to. A child of
+// the first matching parent is spawned when it does not exist yet, but only
+// registered by joinNamespace once the connection is accepted.
+func (s *Io) lookupNamespace(name string, auth map[string]interface{}) *Namespace {
+	if name == "/" {
+		return s.Of(name)
+	}
+	if nps := s.namespaces.get(name); nps != nil {
+		return nps
+	}
+	for _, parent := range s.parents.all() {
+		if parent.matcher(name, auth) != nil {
+			continue
+		}
+		parent.RLock()
+		nps, ok := parent.children[name]
+		parent.RUnlock()
+		if !ok {
+			nps = newNamespace(s, name)
+			nps.parent = parent
+		}
+		return nps
+	}
+	return nil
+}
+
+// joinNamespace adds an accepted socket to nps, registering nps first when
+// it is a child spawned by lookupNamespace, and returns the namespace joined.
+func (s *Io) joinNamespace(nps *Namespace, socket *Socket) *Namespace {
+	parent := nps.parent
+	if parent == nil {
+		nps.sockets.set(socket)
+		return nps
+	}
+	parent.Lock()
+	defer parent.Unlock()
+	if child, ok := parent.children[nps.Name]; ok {
+		nps = child
+	} else if nps = s.namespaces.add(nps); nps.parent == parent {
+		parent.children[nps.Name] = nps
+	}
+	nps.sockets.set(socket)
+	return nps
+}
+
+func (s *Io) cleanupNamespace(nps *Namespace) {
+	parent := nps.parent
+	if parent == nil || !parent.cleanup {
+		return
+	}
+	// Holding the parent lock keeps joinNamespace from adding a socket to nps
+	// while it is removed.
+	parent.Lock()
+	defer parent.Unlock()
+	if len(nps.sockets.all()) > 0 || parent.children[nps.Name] != nps {
+		return
+	}
+	delete(parent.children, nps.Name)
+	s.namespaces.delete(nps.Name)
+}
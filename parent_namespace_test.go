@@ -0,0 +1,86 @@
+package socketio
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParentNamespaceRejectedConnection(t *testing.T) {
+	io, srv := newTestServer(t)
+	tenants := io.OfMatcher(MatchRegexp(regexp.MustCompile(`^/tenant-\d+$`)))
+	tenants.Use(func(socket *Socket, next func() *UseError) *UseError {
+		if socket.Handshake.Auth["token"] != "secret" {
+			return &UseError{Message: "forbidden"}
+		}
+		return next()
+	})
+
+	c := dialTest(t, srv)
+	for _, name := range []string{"/tenant-1", "/tenant-2", "/tenant-3"} {
+		if got := c.connect(name); !strings.HasPrefix(got, "44"+name+",") {
+			t.Fatalf("CONNECT %s = %q, want CONNECT_ERROR", name, got)
+		}
+		if io.namespaces.get(name) != nil {
+			t.Errorf("rejected connection registered %s", name)
+		}
+	}
+	if children := tenants.Children(); len(children) != 0 {
+		t.Errorf("Children() = %d namespaces, want none", len(children))
+	}
+
+	c.send(`40/tenant-1,{"token":"secret"}`)
+	if got := c.read(); !strings.HasPrefix(got, "40/tenant-1,") {
+		t.Fatalf("CONNECT = %q", got)
+	}
+	if nps := io.namespaces.get("/tenant-1"); nps == nil || nps.Parent() != tenants {
+		t.Fatal("accepted connection did not register /tenant-1")
+	}
+}
+
+func TestParentNamespaceCleanup(t *testing.T) {
+	io, srv := newTestServer(t)
+	tenants := io.OfMatcher(MatchRegexp(regexp.MustCompile(`^/tenant-\d+$`)))
+	tenants.CleanupEmptyChildren(true)
+
+	c := dialTest(t, srv)
+	if got := c.connect("/tenant-1"); !strings.HasPrefix(got, "40/tenant-1,") {
+		t.Fatalf("CONNECT = %q", got)
+	}
+	c.conn.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for io.namespaces.get("/tenant-1") != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("empty child namespace not removed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if children := tenants.Children(); len(children) != 0 {
+		t.Errorf("Children() = %d namespaces, want none", len(children))
+	}
+}
+
+func TestJoinNamespaceAfterCleanup(t *testing.T) {
+	io := New()
+	defer io.Close()
+	tenants := io.OfMatcher(MatchRegexp(regexp.MustCompile(`^/tenant-\d+$`)))
+	tenants.CleanupEmptyChildren(true)
+
+	first := &Socket{Id: "first"}
+	nps := io.joinNamespace(io.lookupNamespace("/tenant-1", nil), first)
+	nps.sockets.delete(first.Id)
+
+	// A connection looked the child up, then the last socket left.
+	spawned := io.lookupNamespace("/tenant-1", nil)
+	io.cleanupNamespace(nps)
+	second := &Socket{Id: "second"}
+	joined := io.joinNamespace(spawned, second)
+
+	if io.namespaces.get("/tenant-1") != joined || tenants.Children()[0] != joined {
+		t.Fatal("joined namespace is not registered")
+	}
+	if _, err := joined.sockets.get(second.Id); err != nil {
+		t.Fatal("socket missing from the joined namespace")
+	}
+}
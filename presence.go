@@ -0,0 +1,237 @@
+package socketio
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/doquangtan/socketio/v4/adapter"
+)
+
+// PresenceMember describes a member of a room. ID is the user id of the
+// socket. Without a user, it is the "presenceId" the client sends in its auth
+// payload or query, and else the socket id.
+type PresenceMember struct {
+	ID     string                 `json:"id"`
+	UserID string                 `json:"userId,omitempty"`
+	State  map[string]interface{} `json:"state"`
+}
+
+type presenceEntry struct {
+	member  PresenceMember
+	sockets map[string]bool
+	leave   *time.Timer
+}
+
+// Presence keeps the members of every room of a namespace and emits
+// "presence:join", "presence:leave" and "presence:update" to the room when
+// they change. A member leaving and coming back within the debounce delay,
+// e.g. on reconnect, produces no event.
+type Presence struct {
+	sync.Mutex
+	nps      *Namespace
+	debounce time.Duration
+	// rooms maps each room to its members by presenceKey.
+	rooms map[string]map[string]*presenceEntry
+}
+
+// EnablePresence starts tracking room members of the namespace.
+func (nps *Namespace) EnablePresence(debounce time.Duration) *Presence {
+	nps.Lock()
+	defer nps.Unlock()
+	if nps.presence == nil {
+		nps.presence = &Presence{
+			nps:   nps,
+			rooms: make(map[string]map[string]*presenceEntry),
+		}
+	}
+	nps.presence.debounce = debounce
+	return nps.presence
+}
+
+// Presence returns the presence tracker, nil unless EnablePresence was called.
+func (nps *Namespace) Presence() *Presence {
+	nps.RLock()
+	defer nps.RUnlock()
+	return nps.presence
+}
+
+// PresenceList returns the members of the room on this node.
+func (nps *Namespace) PresenceList(room string) []PresenceMember {
+	if p := nps.Presence(); p != nil {
+		return p.List(room)
+	}
+	return []PresenceMember{}
+}
+
+// FetchPresenceList returns the members of the room on every node, a member
+// connected to several nodes being listed once. Other nodes are given 5
+// seconds to answer; use FetchPresenceListContext to choose.
+func (nps *Namespace) FetchPresenceList(room string) []PresenceMember {
+	ret, _ := nps.FetchPresenceListContext(context.Background(), room)
+	return ret
+}
+
+// FetchPresenceListContext is FetchPresenceList returning ErrorAckTimeout,
+// with the members received so far, when a node does not answer before ctx
+// is done.
+func (nps *Namespace) FetchPresenceListContext(ctx context.Context, room string) ([]PresenceMember, error) {
+	ret := nps.PresenceList(room)
+	if nps.io == nil || nps.io.cluster == nil {
+		return ret, nil
+	}
+	responses, err := nps.io.cluster.request(ctx, adapter.FETCH_PRESENCE, nps.Name, adapter.FetchPresenceData{Room: room})
+	seen := make(map[string]bool, len(ret))
+	for _, member := range ret {
+		seen[member.key()] = true
+	}
+	for _, raw := range responses {
+		res := fetchPresenceResponse{}
+		json.Unmarshal(raw, &res)
+		for _, member := range res.Members {
+			if !seen[member.key()] {
+				seen[member.key()] = true
+				ret = append(ret, member)
+			}
+		}
+	}
+	return ret, err
+}
+
+type fetchPresenceResponse struct {
+	Members []PresenceMember `json:"members"`
+}
+
+func (m PresenceMember) key() string {
+	if m.UserID != "" {
+		return "user:" + m.UserID
+	}
+	return "client:" + m.ID
+}
+
+// presenceKey identifies the member of a socket, so that the sockets of a
+// reconnecting client map to the same member. A client without a user is
+// only recognized when it sends a presenceId.
+func presenceKey(socket *Socket) (key string, id string) {
+	if userId := socket.UserID(); userId != "" {
+		return "user:" + userId, userId
+	}
+	handshake := socket.handshake()
+	if id, ok := handshake.Auth["presenceId"].(string); ok && id != "" {
+		return "client:" + id, id
+	}
+	if id := handshake.Query.Get("presenceId"); id != "" {
+		return "client:" + id, id
+	}
+	return "client:" + socket.Id, socket.Id
+}
+
+func (p *Presence) join(room string, socket *Socket) {
+	key, id := presenceKey(socket)
+	p.Lock()
+	members, ok := p.rooms[room]
+	if !ok {
+		members = make(map[string]*presenceEntry)
+		p.rooms[room] = members
+	}
+	entry, ok := members[key]
+	if ok {
+		entry.sockets[socket.Id] = true
+		if entry.leave != nil {
+			entry.leave.Stop()
+			entry.leave = nil
+		}
+		p.Unlock()
+		return
+	}
+	entry = &presenceEntry{
+		member: PresenceMember{
+			ID:     id,
+			UserID: socket.UserID(),
+			State:  map[string]interface{}{},
+		},
+		sockets: map[string]bool{socket.Id: true},
+	}
+	members[key] = entry
+	member := entry.member
+	p.Unlock()
+
+	p.nps.To(room).Emit("presence:join", member)
+}
+
+func (p *Presence) leave(room string, socket *Socket) {
+	key, _ := presenceKey(socket)
+	p.Lock()
+	entry, ok := p.rooms[room][key]
+	if !ok || !entry.sockets[socket.Id] {
+		p.Unlock()
+		return
+	}
+	delete(entry.sockets, socket.Id)
+	if len(entry.sockets) > 0 {
+		p.Unlock()
+		return
+	}
+	if p.debounce > 0 {
+		entry.leave = time.AfterFunc(p.debounce, func() {
+			p.remove(room, key, entry)
+		})
+		p.Unlock()
+		return
+	}
+	p.Unlock()
+	p.remove(room, key, entry)
+}
+
+func (p *Presence) remove(room string, key string, entry *presenceEntry) {
+	p.Lock()
+	if p.rooms[room][key] != entry || len(entry.sockets) > 0 {
+		p.Unlock()
+		return
+	}
+	delete(p.rooms[room], key)
+	if len(p.rooms[room]) == 0 {
+		delete(p.rooms, room)
+	}
+	member := entry.member
+	p.Unlock()
+
+	p.nps.To(room).Emit("presence:leave", member)
+}
+
+// Update replaces the custom state of the socket's member in the room.
+func (p *Presence) Update(room string, socket *Socket, state map[string]interface{}) {
+	key, _ := presenceKey(socket)
+	p.Lock()
+	entry, ok := p.rooms[room][key]
+	if !ok {
+		p.Unlock()
+		return
+	}
+	entry.member.State = state
+	member := entry.member
+	p.Unlock()
+
+	p.nps.To(room).Emit("presence:update", member)
+}
+
+func (p *Presence) List(room string) []PresenceMember {
+	p.Lock()
+	defer p.Unlock()
+	ret := make([]PresenceMember, 0, len(p.rooms[room]))
+	for _, entry := range p.rooms[room] {
+		ret = append(ret, entry.member)
+	}
+	return ret
+}
+
+// SetPresence updates the custom presence state of the socket in the room.
+func (s *Socket) SetPresence(room string, state map[string]interface{}) {
+	if s.currentNamespace == nil {
+		return
+	}
+	if p := s.currentNamespace().Presence(); p != nil {
+		p.Update(room, s, state)
+	}
+}
@@ -0,0 +1,102 @@
+package socketio
+
+import (
+	"net/url"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/doquangtan/socketio/v4/adapter"
+)
+
+func presenceSocket(id string, userId string, presenceId string) *Socket {
+	socket := &Socket{Id: id, userId: userId}
+	if presenceId != "" {
+		socket.Handshake.Auth = map[string]interface{}{"presenceId": presenceId}
+	}
+	return socket
+}
+
+func memberIDs(members []PresenceMember) []string {
+	ret := make([]string, 0, len(members))
+	for _, member := range members {
+		ret = append(ret, member.ID)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func TestPresenceDebounceWithoutUser(t *testing.T) {
+	io := New()
+	defer io.Close()
+	p := io.Of("/").EnablePresence(time.Minute)
+
+	first := presenceSocket("sid-1", "", "tab-1")
+	p.join("lobby", first)
+	p.leave("lobby", first)
+	// The client reconnects with a new socket id and the same presenceId.
+	second := presenceSocket("sid-2", "", "tab-1")
+	p.join("lobby", second)
+
+	p.Lock()
+	entry := p.rooms["lobby"]["client:tab-1"]
+	p.Unlock()
+	if entry == nil || entry.leave != nil {
+		t.Fatal("reconnect was not debounced")
+	}
+	if ids := memberIDs(p.List("lobby")); len(ids) != 1 || ids[0] != "tab-1" {
+		t.Fatalf("List() = %v, want [tab-1]", ids)
+	}
+}
+
+func TestPresenceQueryIdentity(t *testing.T) {
+	io := New()
+	defer io.Close()
+	p := io.Of("/").EnablePresence(0)
+
+	socket := &Socket{Id: "sid-1"}
+	socket.Handshake.Query = url.Values{"presenceId": {"tab-1"}}
+	anonymous := presenceSocket("sid-2", "", "")
+	// A presenceId cannot take over the member of a user of the same id.
+	user := presenceSocket("sid-3", "tab-1", "")
+	for _, s := range []*Socket{socket, anonymous, user} {
+		p.join("lobby", s)
+	}
+	if got := len(p.List("lobby")); got != 3 {
+		t.Fatalf("List() = %d members, want 3", got)
+	}
+	p.leave("lobby", anonymous)
+	if ids := memberIDs(p.List("lobby")); len(ids) != 2 {
+		t.Fatalf("List() = %v after leave", ids)
+	}
+}
+
+func TestFetchPresenceListAcrossNodes(t *testing.T) {
+	hub := adapter.NewMemoryHub()
+	io1 := New(WithAdapter(hub.Bus()))
+	defer io1.Close()
+	io2 := New(WithAdapter(hub.Bus()))
+	defer io2.Close()
+	p1 := io1.Of("/").EnablePresence(0)
+	p2 := io2.Of("/").EnablePresence(0)
+
+	p1.join("lobby", presenceSocket("sid-1", "alice", ""))
+	p2.join("lobby", presenceSocket("sid-2", "alice", ""))
+	p2.join("lobby", presenceSocket("sid-3", "bob", ""))
+	p2.join("other", presenceSocket("sid-4", "carol", ""))
+
+	deadline := time.Now().Add(5 * time.Second)
+	for io1.Of("/").Adapter().ServerCount() != 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("nodes did not discover each other")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if ids := memberIDs(io1.Of("/").PresenceList("lobby")); len(ids) != 1 {
+		t.Errorf("PresenceList() = %v, want the local member only", ids)
+	}
+	ids := memberIDs(io1.Of("/").FetchPresenceList("lobby"))
+	if len(ids) != 2 || ids[0] != "alice" || ids[1] != "bob" {
+		t.Errorf("FetchPresenceList() = %v, want [alice bob]", ids)
+	}
+}
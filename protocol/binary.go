@@ -0,0 +1,79 @@
+package protocol
+
+import (
+	"bytes"
+	"strconv"
+)
+
+// Deconstruct replaces the []byte values of data with placeholders
+// {"_placeholder":true,"num":n} and returns them as the attachments of a
+// binary packet.
+func Deconstruct(data interface{}) (interface{}, [][]byte) {
+	attachments := [][]byte{}
+	ret := deconstruct(data, &attachments)
+	return ret, attachments
+}
+
+func deconstruct(data interface{}, attachments *[][]byte) interface{} {
+	switch v := data.(type) {
+	case []byte:
+		*attachments = append(*attachments, v)
+		return map[string]interface{}{
+			"_placeholder": true,
+			"num":          len(*attachments) - 1,
+		}
+	case []interface{}:
+		ret := make([]interface{}, len(v))
+		for i, item := range v {
+			ret[i] = deconstruct(item, attachments)
+		}
+		return ret
+	case map[string]interface{}:
+		ret := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			ret[key] = deconstruct(item, attachments)
+		}
+		return ret
+	}
+	return data
+}
+
+// Reconstruct puts the attachments of a binary packet back in place of their
+// placeholders.
+func Reconstruct(data interface{}, attachments [][]byte) interface{} {
+	switch v := data.(type) {
+	case []interface{}:
+		for i, item := range v {
+			v[i] = Reconstruct(item, attachments)
+		}
+	case map[string]interface{}:
+		if placeholder, _ := v["_placeholder"].(bool); placeholder {
+			if num, ok := v["num"].(float64); ok && int(num) >= 0 && int(num) < len(attachments) {
+				return attachments[int(num)]
+			}
+			return nil
+		}
+		for key, item := range v {
+			v[key] = Reconstruct(item, attachments)
+		}
+	}
+	return data
+}
+
+// EncodePacket serializes a packet like Encode. EVENT and ACK packets whose
+// arguments hold []byte values become BINARY_EVENT and BINARY_ACK packets,
+// followed by the returned attachments.
+func EncodePacket(t PacketType, nps string, ack string, arg ...interface{}) ([]byte, [][]byte, error) {
+	var attachments [][]byte
+	if len(arg) > 0 && (t == EVENT || t == ACK) {
+		arg = append([]interface{}{}, arg...)
+		arg[0], attachments = Deconstruct(arg[0])
+		if len(attachments) > 0 {
+			t += BINARY_EVENT - EVENT
+			nps = strconv.Itoa(len(attachments)) + "-" + nps
+		}
+	}
+	var buf bytes.Buffer
+	_, err := WriteToWithAck(&buf, t, nps, ack, arg...)
+	return buf.Bytes(), attachments, err
+}
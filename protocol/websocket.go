@@ -1,6 +1,7 @@
 package protocol
 
 import (
+	"bytes"
 	"encoding/json"
 	"io"
 	"strconv"
@@ -68,3 +69,11 @@ func WriteToWithAck(w io.Writer, t PacketType, nps string, ack string, arg ...in
 		return writer.i, err
 	}
 }
+
+// Encode serializes a packet into the exact bytes WriteTo would produce, so a
+// broadcast can be encoded once and written to every recipient.
+func Encode(t PacketType, nps string, arg ...interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	_, err := WriteTo(&buf, t, nps, arg...)
+	return buf.Bytes(), err
+}
@@ -0,0 +1,189 @@
+package socketio
+
+import (
+	"errors"
+	"sync"
+)
+
+var (
+	ErrorSlowConsumer = errors.New("slow consumer")
+	ErrorQueueClosed  = errors.New("send queue closed")
+)
+
+// SlowConsumerPolicy decides what happens when a socket's send queue is full.
+type SlowConsumerPolicy int
+
+const (
+	// DropOldest discards the oldest queued packet to make room.
+	DropOldest SlowConsumerPolicy = iota
+	// DropVolatile discards volatile packets first: a new volatile packet is
+	// dropped, any other packet evicts the oldest queued volatile packet and
+	// falls back to DropOldest when there is none.
+	DropVolatile
+	// DisconnectSlowConsumer closes the connection with reason "slow consumer".
+	DisconnectSlowConsumer
+)
+
+// SendQueueStats is a snapshot of a socket's outbound queue.
+type SendQueueStats struct {
+	Depth     int
+	Capacity  int
+	HighWater int
+	Dropped   uint64
+}
+
+type outboundPacket struct {
+	data         []byte
+	attachments  [][]byte
+	volatile     bool
+	uncompressed bool
+	// last closes the session once written.
+	last bool
+}
+
+type sendQueue struct {
+	sync.Mutex
+	list       []outboundPacket
+	capacity   int
+	policy     SlowConsumerPolicy
+	ready      chan struct{}
+	done       chan struct{}
+	closed     bool
+	sealed     bool
+	highWater  int
+	dropped    uint64
+	onOverflow func()
+}
+
+func newSendQueue(capacity int, policy SlowConsumerPolicy) *sendQueue {
+	return &sendQueue{
+		capacity: capacity,
+		policy:   policy,
+		ready:    make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+}
+
+func (q *sendQueue) push(p outboundPacket) error {
+	q.Lock()
+	if q.closed || q.sealed {
+		q.Unlock()
+		return ErrorQueueClosed
+	}
+	if q.capacity > 0 && len(q.list) >= q.capacity {
+		switch q.policy {
+		case DropVolatile:
+			q.dropped++
+			if p.volatile {
+				q.Unlock()
+				return nil
+			}
+			index := q.oldestVolatile()
+			q.list = append(q.list[:index], q.list[index+1:]...)
+		case DisconnectSlowConsumer:
+			q.dropped++
+			onOverflow := q.onOverflow
+			q.Unlock()
+			if onOverflow != nil {
+				onOverflow()
+			}
+			return ErrorSlowConsumer
+		default:
+			q.dropped++
+			q.list = q.list[1:]
+		}
+	}
+	q.list = append(q.list, p)
+	if len(q.list) > q.highWater {
+		q.highWater = len(q.list)
+	}
+	q.Unlock()
+
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// oldestVolatile returns the index of the first volatile packet, or 0 when
+// the queue holds none.
+func (q *sendQueue) oldestVolatile() int {
+	for index, p := range q.list {
+		if p.volatile {
+			return index
+		}
+	}
+	return 0
+}
+
+func (q *sendQueue) pop() (outboundPacket, bool) {
+	for {
+		q.Lock()
+		if q.closed {
+			q.Unlock()
+			return outboundPacket{}, false
+		}
+		if len(q.list) > 0 {
+			p := q.list[0]
+			q.list[0] = outboundPacket{}
+			q.list = q.list[1:]
+			q.Unlock()
+			return p, true
+		}
+		q.Unlock()
+
+		select {
+		case <-q.ready:
+		case <-q.done:
+			return outboundPacket{}, false
+		}
+	}
+}
+
+// seal queues p after the pending packets, whatever the capacity, and
+// refuses any later packet. It returns false when the queue is closed.
+func (q *sendQueue) seal(p outboundPacket) bool {
+	q.Lock()
+	if q.closed || q.sealed {
+		q.Unlock()
+		return false
+	}
+	q.sealed = true
+	q.list = append(q.list, p)
+	q.Unlock()
+
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+func (q *sendQueue) isSealed() bool {
+	q.Lock()
+	defer q.Unlock()
+	return q.sealed
+}
+
+func (q *sendQueue) close() {
+	q.Lock()
+	defer q.Unlock()
+	if q.closed {
+		return
+	}
+	q.closed = true
+	q.list = nil
+	close(q.done)
+}
+
+func (q *sendQueue) stats() SendQueueStats {
+	q.Lock()
+	defer q.Unlock()
+	return SendQueueStats{
+		Depth:     len(q.list),
+		Capacity:  q.capacity,
+		HighWater: q.highWater,
+		Dropped:   q.dropped,
+	}
+}
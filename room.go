@@ -1,59 +1,120 @@
 package socketio
 
 import (
+	"context"
 	"sync"
+
+	"github.com/doquangtan/socketio/v4/adapter"
 )
 
 type Room struct {
-	Name           string
-	To             func(room string) *Room
-	sockets        connections
-	connectSockets []*Socket
+	Name    string
+	To      func(room string) *Room
+	sockets connections
+	nps     *Namespace
+	names   []string
 }
 
-func newRoom(name string) *Room {
+func newRoom(nps *Namespace, name string) *Room {
 	return &Room{
 		Name: name,
 		sockets: connections{
 			conn: make(map[string]*Socket),
 		},
+		nps:   nps,
+		names: []string{name},
 	}
 }
 
+// operator selects the sockets of every room of the To chain, on every node.
+func (room *Room) operator() *broadcastOperator {
+	return room.nps.operator(adapter.BroadcastOptions{Rooms: room.names})
+}
+
 func (room *Room) Emit(event string, agrs ...interface{}) error {
-	if len(room.connectSockets) > 0 {
-		for _, socket := range room.connectSockets {
-			socket.Emit(event, agrs...)
-		}
-	} else {
-		for _, socket := range room.sockets.all() {
-			socket.Emit(event, agrs...)
-		}
-	}
-	return nil
+	return room.operator().Emit(event, agrs...)
+}
+
+func (room *Room) Except(rooms ...string) *broadcastOperator {
+	return room.operator().Except(rooms...)
+}
+
+func (room *Room) Volatile() *broadcastOperator {
+	return room.operator().Volatile()
+}
+
+func (room *Room) Compress(compress bool) *broadcastOperator {
+	return room.operator().Compress(compress)
 }
 
 func (room *Room) Sockets() []*Socket {
 	return room.sockets.all()
 }
 
+// FetchSockets returns a snapshot of the sockets of the rooms, on every node.
+func (room *Room) FetchSockets() []RemoteSocket {
+	return room.operator().FetchSockets()
+}
+
+func (room *Room) FetchSocketsContext(ctx context.Context) ([]RemoteSocket, error) {
+	return room.operator().FetchSocketsContext(ctx)
+}
+
+// SocketsJoin makes the sockets of the rooms, on every node, join more rooms.
+func (room *Room) SocketsJoin(rooms ...string) {
+	room.operator().SocketsJoin(rooms...)
+}
+
+func (room *Room) SocketsLeave(rooms ...string) {
+	room.operator().SocketsLeave(rooms...)
+}
+
+func (room *Room) DisconnectSockets() {
+	room.operator().DisconnectSockets()
+}
+
 type roomNames struct {
 	sync.RWMutex
 	list []string
 }
 
-func (l *roomNames) set(name string) {
+// add appends the name unless it is already listed, and runs fn under the
+// same lock before it does, so that a concurrent add of the name waits for
+// fn and then sees it listed.
+func (l *roomNames) add(name string, fn func()) bool {
 	l.Lock()
+	defer l.Unlock()
+	if l.index(name) != -1 {
+		return false
+	}
+	fn()
 	l.list = append(l.list, name)
-	l.Unlock()
+	return true
 }
 
-func (l *roomNames) delete(name string) int {
+// remove is the counterpart of add, running fn under the lock once the name
+// is removed.
+func (l *roomNames) remove(name string, fn func()) bool {
 	l.Lock()
 	defer l.Unlock()
+	index := l.index(name)
+	if index == -1 {
+		return false
+	}
+	l.list = append(l.list[:index], l.list[index+1:]...)
+	fn()
+	return true
+}
+
+func (l *roomNames) has(name string) bool {
+	l.RLock()
+	defer l.RUnlock()
+	return l.index(name) != -1
+}
+
+func (l *roomNames) index(name string) int {
 	for index, n := range l.list {
 		if n == name {
-			l.list = append(l.list[:index], l.list[index+1:]...)
 			return index
 		}
 	}
@@ -79,17 +140,47 @@ func (l *roomNames) all() []string {
 
 type rooms struct {
 	sync.RWMutex
+	nps  *Namespace
 	list map[string]*Room
 }
 
-func (n *rooms) create(name string) *Room {
+// join adds the socket to the room and reports whether the room was created.
+func (n *rooms) join(name string, socket *Socket) bool {
 	n.Lock()
+	defer n.Unlock()
 	ret, ok := n.list[name]
 	if !ok {
-		ret = newRoom(name)
+		ret = newRoom(n.nps, name)
 		n.list[name] = ret
 	}
-	n.Unlock()
+	ret.sockets.set(socket)
+	return !ok
+}
+
+// leave removes the socket from the room and deletes the room once it is
+// empty, reporting whether it did.
+func (n *rooms) leave(name string, id string) bool {
+	n.Lock()
+	defer n.Unlock()
+	ret, ok := n.list[name]
+	if !ok {
+		return false
+	}
+	ret.sockets.delete(id)
+	if len(ret.sockets.all()) > 0 {
+		return false
+	}
+	delete(n.list, name)
+	return true
+}
+
+func (n *rooms) names() []string {
+	n.RLock()
+	defer n.RUnlock()
+	ret := make([]string, 0, len(n.list))
+	for name := range n.list {
+		ret = append(ret, name)
+	}
 	return ret
 }
 
@@ -97,23 +188,22 @@ func (n *rooms) next(name string, preRoom ...*Room) *Room {
 	n.Lock()
 	ret, ok := n.list[name]
 	if !ok {
-		ret = newRoom(name)
-		n.list[name] = ret
+		// Broadcasting to an unknown room must not create it.
+		ret = newRoom(n.nps, name)
 	}
 	if len(preRoom) == 0 {
-		newRoom := newRoom(name)
-		newRoom.connectSockets = append(newRoom.connectSockets, ret.sockets.all()...)
+		newRoom := newRoom(n.nps, name)
 		ret.To = func(room string) *Room {
 			nextRoom := n.next(room, newRoom)
 			newRoom.Name += "_" + nextRoom.Name
-			newRoom.connectSockets = append(newRoom.connectSockets, nextRoom.sockets.all()...)
+			newRoom.names = append(newRoom.names, nextRoom.Name)
 			return newRoom
 		}
 	} else {
 		ret.To = func(room string) *Room {
 			nextRoom := n.next(room, preRoom[0])
 			preRoom[0].Name += "_" + nextRoom.Name
-			preRoom[0].connectSockets = append(preRoom[0].connectSockets, nextRoom.sockets.all()...)
+			preRoom[0].names = append(preRoom[0].names, nextRoom.Name)
 			return preRoom[0]
 		}
 	}
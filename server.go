@@ -4,15 +4,13 @@ import (
 	"context"
 	"embed"
 	"encoding/json"
-	"errors"
-	"fmt"
 	"io/fs"
 	"net/http"
-	"reflect"
-	"slices"
+	"runtime"
 	"strings"
-	"time"
+	"sync"
 
+	"github.com/doquangtan/socketio/v4/adapter"
 	"github.com/doquangtan/socketio/v4/client"
 	"github.com/doquangtan/socketio/v4/engineio"
 	"github.com/doquangtan/socketio/v4/protocol"
@@ -49,25 +47,29 @@ func (e UseError) Error() string {
 }
 
 type Io struct {
-	pingInterval     time.Duration
-	pingTimeout      time.Duration
-	maxPayload       int
-	namespaces       namespaces
-	sockets          connections
-	readChan         chan payload
-	onAuthentication func(params map[string]string) bool
-	onConnection     connectionEvent
-	use              func(socket *Socket, next func() *UseError) *UseError
-	close            chan interface{}
-}
-
-func New() *Io {
-	pingInterval := time.Duration(25000 * time.Millisecond)
-	pingTimeout := time.Duration(25000 * time.Millisecond)
-	maxPayload := 1000000
+	engine             *engineio.Server
+	engineConfig       engineio.Config
+	sendQueueCapacity  int
+	slowConsumerPolicy SlowConsumerPolicy
+	dispatchMode       DispatchMode
+	dispatchWorkers    int
+	namespaces         namespaces
+	parents            parentNamespaces
+	sockets            connections
+	shards             []chan payload
+	bus                adapter.Bus
+	cluster            *cluster
+	forwarder          *forwarder
+	ctx                context.Context
+	onAuthentication   func(params map[string]string) bool
+	onConnection       connectionEvent
+	use                func(socket *Socket, next func() *UseError) *UseError
+	close              chan interface{}
+}
+
+func New(opts ...Option) *Io {
 	io := &Io{
-		readChan: make(chan payload),
-		close:    make(chan interface{}),
+		close: make(chan interface{}),
 		onConnection: connectionEvent{
 			list: make(map[string][]connectionEventCallback),
 		},
@@ -77,105 +79,47 @@ func New() *Io {
 		sockets: connections{
 			conn: make(map[string]*Socket),
 		},
-		pingInterval: pingInterval,
-		pingTimeout:  pingTimeout,
-		maxPayload:   maxPayload,
+		slowConsumerPolicy: DisconnectSlowConsumer,
+		dispatchMode:       DispatchSharded,
+		dispatchWorkers:    runtime.GOMAXPROCS(0),
+	}
+	io.namespaces.io = io
+	for _, opt := range opts {
+		opt(io)
 	}
+	if io.forwarder != nil {
+		io.engineConfig.GenerateID = io.newSid
+	}
+	io.engine = engineio.NewServer(io.engineConfig)
+	io.engine.OnConnection(io.onSession)
 	ctx, cancelFunc := context.WithCancel(context.Background())
-	go io.read(ctx)
-	go io.ping(ctx)
+	io.ctx = ctx
+	io.startDispatch(ctx)
+	if io.bus != nil {
+		io.cluster = newCluster(io, io.bus)
+		io.cluster.start(ctx)
+	}
 	go func() {
 		<-io.close
+		io.engine.Close()
 		cancelFunc()
+		if io.cluster != nil {
+			io.cluster.close()
+		}
 	}()
 	return io
 }
 
-var upgrader = gWebsocket.Upgrader{}
-
 func (s *Io) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	header := r.Header
-	query := r.URL.Query()
-	transport := query.Get("transport")
-	sid := query.Get("sid")
-	if transport == "websocket" &&
-		slices.Contains(header["Connection"], "Upgrade") &&
-		header.Get("Upgrade") == "websocket" {
-		upgrader.CheckOrigin = func(r *http.Request) bool { return true }
-		c, err := upgrader.Upgrade(w, r, nil)
-
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
-		defer c.Close()
-
-		var socket *Socket
-		if sid != "" {
-			socket, err = s.sockets.get(sid)
-			if err != nil {
-				http.Error(w, "unknown session", http.StatusBadRequest)
-				return
-			}
-			socket.Conn.http = c
-			defer socket.disconnect()
-		} else {
-			socket = &Socket{
-				Id:  s.randomUUID(),
-				Nps: "/",
-				Conn: &Conn{
-					http: c,
-				},
-				listeners: listeners{
-					list: make(map[string][]eventCallback),
-				},
-				pingTime: s.pingInterval,
-			}
-			defer socket.disconnect()
-			socket.dispose = append(socket.dispose, func() {
-				s.sockets.delete(socket.Id)
-			})
-			s.sockets.set(socket)
-
-			socket.engineWrite(engineio.OPEN, engineio.ConnParameters{
-				SID:          socket.Id,
-				PingInterval: s.pingInterval,
-				PingTimeout:  s.pingTimeout,
-				MaxPayload:   s.maxPayload,
-				Upgrades:     []string{},
-			}.ToJson())
-		}
-
-		for {
-			messageType, message, err := c.ReadMessage()
-			if err != nil {
-				break
-			}
-
-			if messageType == websocket.TextMessage {
-				err := s.handlerMessage(socket, string(message))
-				if err != nil {
-					return
-				}
-			}
-		}
+	if r.URL.Query().Get("sid") != "" && s.forward(w, r) {
+		return
+	}
+	if r.URL.Query().Get("transport") == "websocket" && gWebsocket.IsWebSocketUpgrade(r) {
+		s.engine.ServeHTTP(w, r)
 	} else if strings.HasPrefix(r.URL.Path, "/socket.io/") {
 		fileName := strings.Replace(r.URL.Path, "/socket.io/", "", 1)
 		if fileName == "" {
-			if transport == "polling" {
-				switch r.Method {
-				case http.MethodGet:
-					if sid == "" {
-						s.handleHandshake(w, r)
-						return
-					}
-					s.handlePoll(w, r)
-				case http.MethodPost:
-					s.handlePost(w, r)
-				default:
-					http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
-				}
-			}
+			s.engine.ServeHTTP(w, r)
 			return
 		}
 		clientDistFs, _ := fs.Sub(staticFS, "client-dist")
@@ -205,8 +149,8 @@ func (s *Io) FiberRoute(router fiber.Router) {
 		}
 		return fiber.ErrUpgradeRequired
 	})
-	router.Get("/", s.new())
-	router.Post("/", s.fiberHandlerPost())
+	router.Get("/", s.fiberHandler)
+	router.Post("/", s.fiberHandler)
 }
 
 func (s *Io) FiberMiddleware(c *fiber.Ctx) error {
@@ -232,514 +176,367 @@ func (s *Io) Sockets() []*Socket {
 	return s.Of("/").Sockets()
 }
 
-func (s *Io) OnConnection(fn connectionEventCallback) {
-	s.Of("/").onConnection.set("connection", fn)
+func (s *Io) FetchSockets() []RemoteSocket {
+	return s.Of("/").FetchSockets()
 }
 
-func (s *Io) OnAuthentication(fn func(params map[string]string) bool) {
-	s.onAuthentication = fn
+func (s *Io) FetchSocketsContext(ctx context.Context) ([]RemoteSocket, error) {
+	return s.Of("/").FetchSocketsContext(ctx)
 }
 
-func (s *Io) Use(fn func(socket *Socket, next func() *UseError) *UseError) {
-	s.use = fn
+func (s *Io) Except(rooms ...string) *broadcastOperator {
+	return s.Of("/").Except(rooms...)
 }
 
-func (s *Io) Emit(event string, agrs ...interface{}) error {
-	return s.Of("/").Emit(event, agrs...)
+func (s *Io) SocketsJoin(rooms ...string) {
+	s.Of("/").SocketsJoin(rooms...)
 }
 
-func (s *Io) read(ctx context.Context) {
-	for {
-		select {
-		case payLoad := <-s.readChan:
-			if payLoad.socket.Conn == nil {
-				continue
-			}
-			dataJson := []interface{}{}
-			json.Unmarshal([]byte(payLoad.data.(string)), &dataJson)
-			if len(dataJson) > 0 {
-				if reflect.TypeOf(dataJson[0]).String() == "string" {
-					event := dataJson[0].(string)
-					for _, callback := range payLoad.socket.listeners.get(event) {
-						data := append([]interface{}{}, dataJson[1:]...)
-
-						ackCallback := AckCallback(func(data ...interface{}) {
-							payLoad.socket.ack(payLoad.ackId, data...)
-						})
-
-						if payLoad.ackId == "" {
-							callback(&EventPayload{
-								SID:    payLoad.socket.Id,
-								Name:   event,
-								Socket: payLoad.socket,
-								Error:  nil,
-								Data:   data,
-								Ack:    nil,
-							})
-						} else {
-							callback(&EventPayload{
-								SID:    payLoad.socket.Id,
-								Name:   event,
-								Socket: payLoad.socket,
-								Error:  nil,
-								Data:   data,
-								Ack:    ackCallback,
-							})
-						}
-					}
-				}
-			}
-		case <-ctx.Done():
-			return
-		}
-	}
+func (s *Io) SocketsLeave(rooms ...string) {
+	s.Of("/").SocketsLeave(rooms...)
 }
 
-func (s *Io) ping(ctx context.Context) {
-	timeoutTicker := time.NewTicker(time.Duration(1 * time.Second))
-	defer timeoutTicker.Stop()
-	for {
-		select {
-		case <-timeoutTicker.C:
-			for _, socket := range s.sockets.all() {
-				if socket != nil && socket.pingTime > 0 {
-					socket.pingTime = time.Duration(socket.pingTime - time.Duration(1*time.Second))
-					if socket.pingTime <= 0 {
-						err := socket.Ping()
-						if err != nil {
-							s.sockets.delete(socket.Id)
-						} else {
-							socket.pingTime = s.pingInterval
-						}
-					}
-				}
-			}
-		case <-ctx.Done():
-			return
-		}
-	}
+func (s *Io) DisconnectSockets() {
+	s.Of("/").DisconnectSockets()
 }
 
-func (s *Io) randomUUID() string {
-	return uuid.New().String()
+func (s *Io) OnConnection(fn connectionEventCallback) {
+	s.Of("/").onConnection.set("connection", fn)
 }
 
-func (s *Io) new() func(ctx *fiber.Ctx) error {
-	return func(ctx *fiber.Ctx) error {
-		if ctx.Query("transport") == "websocket" {
-			return s.handleWebsocket(ctx)
-		} else if ctx.Query("transport") == "polling" {
-			if ctx.Query("sid") == "" {
-				return adaptor.HTTPHandlerFunc(s.handleHandshake)(ctx)
-			}
-			return adaptor.HTTPHandlerFunc(s.handlePoll)(ctx)
-		} else {
-			return ctx.SendStatus(404)
-		}
-	}
+// OnConnectionError is called with the requests the Engine.IO server
+// rejects, e.g. polls of an unknown session.
+func (s *Io) OnConnectionError(fn func(err *engineio.ConnectionError)) {
+	s.engine.OnConnectionError(fn)
 }
 
-func (s *Io) fiberHandlerPost() func(ctx *fiber.Ctx) error {
-	return func(ctx *fiber.Ctx) error {
-		return adaptor.HTTPHandlerFunc(s.handlePost)(ctx)
-	}
+// Deprecated: OnAuthentication drops non-string fields of the payload and
+// applies to every namespace. Use OnAuthenticate instead.
+func (s *Io) OnAuthentication(fn func(params map[string]string) bool) {
+	s.onAuthentication = fn
 }
 
-func (s *Io) handleWebsocket(ctx *fiber.Ctx) error {
-	return websocket.New(func(c *websocket.Conn) {
-		var socket *Socket
-		var err error
-		if c.Query("sid") != "" {
-			socket, err = s.sockets.get(c.Query("sid"))
-			if err != nil {
-				ctx.Status(http.StatusBadRequest).SendString("unknown session")
-				return
-			}
-			socket.Conn.fasthttp = c
-			defer socket.disconnect()
-		} else {
-			socket = &Socket{
-				Id:  s.randomUUID(),
-				Nps: "/",
-				Conn: &Conn{
-					fasthttp: c,
-				},
-				listeners: listeners{
-					list: make(map[string][]eventCallback),
-				},
-				pingTime: s.pingInterval,
-			}
-			defer socket.disconnect()
-			socket.dispose = append(socket.dispose, func() {
-				s.sockets.delete(socket.Id)
-			})
-			s.sockets.set(socket)
-
-			socket.engineWrite(engineio.OPEN, engineio.ConnParameters{
-				SID:          socket.Id,
-				PingInterval: s.pingInterval,
-				PingTimeout:  s.pingTimeout,
-				MaxPayload:   s.maxPayload,
-				Upgrades:     []string{},
-			}.ToJson())
-		}
+func (s *Io) OnAuthenticate(fn AuthenticateFunc) {
+	s.Of("/").OnAuthenticate(fn)
+}
 
-		for {
-			messageType, message, err := c.ReadMessage()
-			if err != nil {
-				// if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				// }
-				return
-			}
+func (s *Io) Use(fn func(socket *Socket, next func() *UseError) *UseError) {
+	s.use = fn
+}
 
-			if messageType == websocket.TextMessage {
-				err := s.handlerMessage(socket, string(message))
-				if err != nil {
-					return
-				}
-			}
-		}
-	})(ctx)
+func (s *Io) Emit(event string, agrs ...interface{}) error {
+	return s.Of("/").Emit(event, agrs...)
 }
 
-func (s *Io) handleHandshake(w http.ResponseWriter, r *http.Request) {
+// namespaceSocket returns the socket connected to the namespace without
+// creating the namespace, which may have been cleaned up.
+func (s *Io) namespaceSocket(namespace string, id string) (*Socket, error) {
+	nps := s.namespaces.get(namespace)
+	if nps == nil {
+		return nil, ErrorInvalidConnection
+	}
+	return nps.sockets.get(id)
+}
+
+func (s *Io) newSocket(session *engineio.Session) *Socket {
 	socket := &Socket{
-		Id:  s.randomUUID(),
-		Nps: "/",
-		Conn: &Conn{
-			polling: &protocol.Polling{
-				Ready: make(chan struct{}),
-			},
-		},
+		Id:        session.ID(),
+		Nps:       "/",
+		Conn:      newConn(session, s.sendQueueCapacity, s.slowConsumerPolicy),
+		Handshake: session.Handshake(),
+		Data:      newSocketData(),
 		listeners: listeners{
 			list: make(map[string][]eventCallback),
 		},
-		pingTime: s.pingInterval,
-		Handshake: engineio.Handshake{
-			Headers: r.Header,
-			URL:     r.RequestURI,
-		},
 	}
+	socket.ctx, socket.cancel = context.WithCancel(s.ctx)
+	socket.Conn.disconnect = socket.disconnectWithReason
+	socket.Conn.queue.onOverflow = func() {
+		go socket.disconnectWithReason("slow consumer")
+	}
+	return socket
+}
+
+// onSession runs the Socket.IO protocol over a new Engine.IO session. Engine.IO
+// v3 clients are connected to the root namespace implicitly.
+func (s *Io) onSession(session *engineio.Session) {
+	socket := s.newSocket(session)
 	socket.dispose = append(socket.dispose, func() {
 		s.sockets.delete(socket.Id)
 	})
 	s.sockets.set(socket)
+	session.OnMessage(func(data string) {
+		if err := s.handlerMessage(socket, data); err != nil {
+			socket.disconnect()
+		}
+	})
+	session.OnBinary(func(data []byte) {
+		s.handleBinary(socket, data)
+	})
+	session.OnClose(socket.disconnectWithReason)
+	if session.EIO() == 3 {
+		s.handlerMessage(socket, protocol.CONNECT.String())
+	}
+}
 
-	socket.engineWrite(engineio.OPEN, engineio.ConnParameters{
-		SID:          socket.Id,
-		PingInterval: s.pingInterval,
-		PingTimeout:  s.pingTimeout,
-		MaxPayload:   s.maxPayload,
-		Upgrades:     []string{"websocket"},
-	}.ToJson())
-	socket.Conn.polling.Flush(w)
+func (s *Io) randomUUID() string {
+	return uuid.New().String()
 }
 
-func (s *Io) handlePost(w http.ResponseWriter, r *http.Request) {
-	q := r.URL.Query()
-	if q.Get("EIO") != "4" {
-		http.Error(w, "unsupported EIO version", http.StatusBadRequest)
-		return
-	}
-	if q.Get("transport") != "polling" {
-		http.Error(w, "unsupported transport", http.StatusBadRequest)
-		return
+func (s *Io) newSid() string {
+	if s.forwarder != nil {
+		return s.forwarder.sid(s.randomUUID())
 	}
+	return s.randomUUID()
+}
 
-	sid := q.Get("sid")
-	if sid == "" {
-		w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
-		fmt.Fprint(w, "ok")
-		return
+// fiberHandler forwards the polling requests of the sessions of other nodes.
+// The websocket upgrades are not forwarded: fasthttp hijacks the connection,
+// which the reverse proxy cannot take over.
+func (s *Io) fiberHandler(ctx *fiber.Ctx) error {
+	if ctx.Query("sid") != "" && ctx.Query("transport") == "polling" {
+		return adaptor.HTTPHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !s.forward(w, r) {
+				s.engine.ServeHTTP(w, r)
+			}
+		})(ctx)
 	}
+	return s.engine.FiberHandler(ctx)
+}
 
-	socket, err := s.sockets.get(sid)
-	if err != nil {
-		w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
-		fmt.Fprint(w, "ok")
-		return
-	}
+// splitPacket parses a Socket.IO packet: "4<type>[<namespace>,][<ackId>][<payload>]".
+func splitPacket(message string) (packetType string, namespace string, ackId string, rawpayload string) {
+	mess := string(message)
+	packetType = string(message[1:2])
+	rawpayload = string(message[2:])
 
-	body := make([]byte, r.ContentLength)
-	r.Body.Read(body)
-	r.Body.Close()
+	endNamespace := -1
+	startPayload := -1
 
-	Separator := "\x1e"
-	payload := string(body)
-	packets := strings.Split(payload, Separator)
+	special1 := strings.Index(mess, "{")
+	special2 := strings.Index(mess, "[")
+	special3 := -1
+	nextMess := message
 
-	for _, pkt := range packets {
-		if len(pkt) == 0 {
-			continue
-		}
-		err := s.handlerMessage(socket, pkt)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
+	if special1 > special2 && special2 != -1 {
+		special1 = -1
 	}
 
-	w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
-	fmt.Fprint(w, "ok")
-}
-
-func (s *Io) handlePoll(w http.ResponseWriter, r *http.Request) {
-	q := r.URL.Query()
-	if q.Get("EIO") != "4" {
-		http.Error(w, "unsupported EIO version", http.StatusBadRequest)
-		return
+	if special2 > special1 && special1 != -1 {
+		special2 = -1
 	}
-	if q.Get("transport") != "polling" {
-		http.Error(w, "unsupported transport", http.StatusBadRequest)
-		return
+
+	offsetSpecial3 := 0
+	for {
+		nextSpecial3 := strings.Index(string(nextMess), ",")
+		if nextSpecial3 != -1 {
+			nextSpecial3 += offsetSpecial3
+		}
+		if nextSpecial3 == -1 || (special1 != -1 && nextSpecial3 > special1) || (special2 != -1 && nextSpecial3 > special2) {
+			break
+		}
+		nextMess = nextMess[nextSpecial3+1:]
+		offsetSpecial3 += nextSpecial3
+		special3 = nextSpecial3
 	}
 
-	sid := q.Get("sid")
-	if sid == "" {
-		w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
-		fmt.Fprint(w, engineio.NOOP.String())
-		return
+	if special3 != -1 {
+		endNamespace = special3
 	}
 
-	socket, err := s.sockets.get(sid)
-	if err != nil {
-		w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
-		fmt.Fprint(w, engineio.NOOP.String())
-		return
+	startPayload = endNamespace
+	if special2 != -1 {
+		startPayload = special2 - 1
+	} else if special1 != -1 {
+		startPayload = special1 - 1
 	}
 
-	// Flush ngay nếu đã có data
-	err = socket.Conn.polling.Flush(w)
-	if err == nil {
-		return
+	if special3 != -1 && special2 != -1 && (special2-1 != special3) {
+		ackId = string(message[special3+1 : special2])
+	} else if special2 != -1 && special2 != 2 {
+		ackId = string(message[2:special2])
 	}
 
-	// Không có data → chờ (long-poll)
-	timeout := time.NewTimer(s.pingInterval)
-	defer timeout.Stop()
+	namespace = "/"
+	if endNamespace != -1 {
+		namespace = string(message[2:endNamespace])
+	}
 
-	select {
-	case <-socket.Conn.polling.Ready:
-		if socket.Conn != nil {
-			socket.Conn.polling.Flush(w)
-		}
-	case <-timeout.C:
-		if socket.Conn != nil {
-			socket.engineWrite(engineio.NOOP)
-			socket.Conn.polling.Flush(w)
-		}
-	case <-r.Context().Done():
-		socket.disconnect()
+	if startPayload != -1 {
+		rawpayload = string(message[startPayload+1:])
 	}
+	return packetType, namespace, ackId, rawpayload
 }
 
+// handlerMessage handles a Socket.IO packet, the data of an Engine.IO message.
 func (s *Io) handlerMessage(socket *Socket, message string) error {
-	enginePacketType := string(message[0:1])
-	anyAfterPacketType := string(message[1:])
-	switch enginePacketType {
-	case engineio.MESSAGE.String():
-		mess := string(message)
-		packetType := string(message[1:2])
-		rawpayload := string(message[2:])
-
-		endNamespace := -1
-		startPayload := -1
-		ackId := ""
-
-		special1 := strings.Index(mess, "{")
-		special2 := strings.Index(mess, "[")
-		special3 := -1
-		nextMess := message
-
-		if special1 > special2 && special2 != -1 {
-			special1 = -1
-		}
-
-		if special2 > special1 && special1 != -1 {
-			special2 = -1
-		}
-
-		offsetSpecial3 := 0
-		for {
-			nextSpecial3 := strings.Index(string(nextMess), ",")
-			if nextSpecial3 != -1 {
-				nextSpecial3 += offsetSpecial3
-			}
-			if nextSpecial3 == -1 || (special1 != -1 && nextSpecial3 > special1) || (special2 != -1 && nextSpecial3 > special2) {
-				break
-			}
-			nextMess = nextMess[nextSpecial3+1:]
-			offsetSpecial3 += nextSpecial3
-			special3 = nextSpecial3
-		}
-
-		if special3 != -1 {
-			endNamespace = special3
-		}
+	if message == "" {
+		return nil
+	}
+	packetType, namespace, ackId, rawpayload := splitPacket(engineio.MESSAGE.String() + message)
 
-		startPayload = endNamespace
-		if special2 != -1 {
-			startPayload = special2 - 1
-		} else if special1 != -1 {
-			startPayload = special1 - 1
+	switch packetType {
+	case protocol.DISCONNECT.String():
+		socket_nps, err := s.namespaceSocket(namespace, socket.Id)
+		if err != nil {
+			return err
 		}
-
-		if special3 != -1 && special2 != -1 && (special2-1 != special3) {
-			ackId = string(message[special3+1 : special2])
-		} else if special2 != -1 && special2 != 2 {
-			ackId = string(message[2:special2])
+		for _, callback := range socket_nps.listeners.get("disconnecting") {
+			callback(&EventPayload{
+				SID:    socket.Id,
+				Name:   "disconnecting",
+				Socket: socket_nps,
+				Error:  nil,
+				Data:   []interface{}{},
+			})
 		}
-
-		namespace := "/"
-		if endNamespace != -1 {
-			namespace = string(message[2:endNamespace])
+	case protocol.CONNECT.String():
+		auth := map[string]interface{}{}
+		json.Unmarshal([]byte(rawpayload), &auth)
+
+		socket_nps := socket
+		if namespace != "/" {
+			// The socket of the namespace gets its Auth before it is
+			// published, the root socket under its lock.
+			handshake := socket.handshake()
+			handshake.Auth = auth
+			socketWithNamespace := Socket{
+				Id:        socket.Id,
+				Nps:       namespace,
+				Conn:      socket.conn(),
+				Handshake: handshake,
+				Data:      newSocketData(),
+				listeners: listeners{
+					list: make(map[string][]eventCallback),
+				},
+			}
+			socketWithNamespace.ctx, socketWithNamespace.cancel = context.WithCancel(socket.Context())
+			socket_nps = &socketWithNamespace
+		} else {
+			socket.Lock()
+			socket.Handshake.Auth = auth
+			socket.Unlock()
 		}
-
-		if startPayload != -1 {
-			rawpayload = string(message[startPayload+1:])
+		nps := s.lookupNamespace(namespace, auth)
+		if nps == nil {
+			socket_nps.writer(protocol.CONNECT_ERROR, map[string]interface{}{
+				"message": "Invalid namespace",
+			})
+			// continue
+			return nil
 		}
 
-		switch packetType {
-		case protocol.DISCONNECT.String():
-			socket_nps, err := s.Of(namespace).sockets.get(socket.Id)
-			if err != nil {
-				return err
+		for _, use := range []func(socket *Socket, next func() *UseError) *UseError{s.use, nps.middleware()} {
+			if use == nil {
+				continue
 			}
-			for _, callback := range socket_nps.listeners.get("disconnecting") {
-				callback(&EventPayload{
-					SID:    socket.Id,
-					Name:   "disconnecting",
-					Socket: socket_nps,
-					Error:  nil,
-					Data:   []interface{}{},
+			useError := use(socket_nps, func() *UseError {
+				return nil
+			})
+			if useError != nil {
+				socket_nps.writer(protocol.CONNECT_ERROR, map[string]interface{}{
+					"message": useError.Message,
+					"data":    useError.Data,
 				})
+				// continue
+				return nil
 			}
-		case protocol.CONNECT.String():
-			socket_nps := socket
-			if namespace != "/" {
-				socketWithNamespace := Socket{
-					Id:   socket.Id,
-					Nps:  namespace,
-					Conn: socket.Conn,
-					listeners: listeners{
-						list: make(map[string][]eventCallback),
-					},
-					pingTime: s.pingInterval,
-				}
-				socket_nps = &socketWithNamespace
+		}
 
-				if nps := s.namespaces.get(namespace); nps == nil {
-					socket_nps.writer(protocol.CONNECT_ERROR, map[string]interface{}{
-						"message": "Invalid namespace",
-					})
-					// continue
-					return nil
-				}
+		if authenticate := nps.authenticator(); authenticate != nil {
+			principal, err := nps.authenticate(authenticate, socket_nps, auth)
+			if err != nil {
+				socket_nps.writer(protocol.CONNECT_ERROR, connectErrorData(err))
+				// continue
+				return nil
 			}
-
-			if s.use != nil {
-				err := s.use(socket_nps, func() *UseError {
-					return nil
+			socket_nps.Lock()
+			socket_nps.principal = principal
+			socket_nps.Unlock()
+		} else if s.onAuthentication != nil {
+			dataJson := map[string]string{}
+			json.Unmarshal([]byte(rawpayload), &dataJson)
+			if !s.onAuthentication(dataJson) {
+				socket_nps.writer(protocol.CONNECT_ERROR, map[string]interface{}{
+					"message": "Not authenticated",
 				})
-				var useError *UseError
-				if errors.As(err, &useError) {
-					socket_nps.writer(protocol.CONNECT_ERROR, map[string]interface{}{
-						"message": useError.Message,
-						"data":    useError.Data,
-					})
-					// continue
-					return nil
-				}
+				// continue
+				return nil
 			}
+		}
 
-			if s.onAuthentication != nil {
-				dataJson := map[string]string{}
-				json.Unmarshal([]byte(rawpayload), &dataJson)
-				if !s.onAuthentication(dataJson) {
-					socket_nps.writer(protocol.CONNECT_ERROR, map[string]interface{}{
-						"message": "Not authenticated",
-					})
-					// continue
-					return nil
+		nps = s.joinNamespace(nps, socket_nps)
+		var leaveOnce sync.Once
+		leave := func(reason string) {
+			leaveOnce.Do(func() {
+				socket_nps.Lock()
+				socket_nps.left = true
+				socket_nps.Unlock()
+				nps.socketLeaveAllRooms(socket_nps)
+				nps.sockets.delete(socket_nps.Id)
+				if userId := socket_nps.UserID(); userId != "" {
+					nps.userLeave(userId, socket_nps)
 				}
-			}
-
-			socket.dispose = append(socket.dispose, func() {
-				s.Of(namespace).socketLeaveAllRooms(socket_nps)
-				s.Of(namespace).sockets.delete(socket_nps.Id)
 				for _, callback := range socket_nps.listeners.get("disconnect") {
 					callback(&EventPayload{
 						SID:    socket_nps.Id,
 						Name:   "disconnect",
 						Socket: socket_nps,
 						Error:  nil,
-						Data:   []interface{}{},
+						Data:   []interface{}{reason},
 					})
 				}
+				if socket_nps != socket {
+					socket_nps.cancel()
+				}
+				s.cleanupNamespace(nps)
 			})
+		}
+		socket_nps.Lock()
+		socket_nps.leave = leave
+		socket_nps.Unlock()
+		socket.dispose = append(socket.dispose, func() {
+			leave(socket.reason)
+		})
 
-			s.Of(namespace).sockets.set(socket_nps)
-			socket_nps.Join = func(room string) {
-				s.Of(namespace).socketJoinRoom(room, socket_nps)
-			}
-			socket_nps.Leave = func(room string) {
-				s.Of(namespace).socketLeaveRoom(room, socket_nps)
-			}
-			socket_nps.To = func(room string) *Room {
-				return s.Of(namespace).To(room)
-			}
-			socket_nps.currentNamespace = func() *Namespace {
-				return s.Of(namespace)
-			}
+		socket_nps.Join = func(room string) {
+			nps.socketJoinRoom(room, socket_nps)
+		}
+		socket_nps.Leave = func(room string) {
+			nps.socketLeaveRoom(room, socket_nps)
+		}
+		socket_nps.To = func(room string) *Room {
+			return nps.To(room)
+		}
+		socket_nps.currentNamespace = func() *Namespace {
+			return nps
+		}
 
-			socket_nps.writer(protocol.CONNECT, engineio.ConnParameters{
-				SID: socket.Id,
-			}.ToJson())
+		socket_nps.writer(protocol.CONNECT, engineio.ConnParameters{
+			SID: socket.Id,
+		}.ToJson())
 
-			for _, callback := range s.Of(namespace).onConnection.get("connection") {
-				callback(socket_nps)
-			}
-		case protocol.EVENT.String():
-			socket_nps, err := s.Of(namespace).sockets.get(socket.Id)
-			if err != nil {
-				return err
-			}
-			if socket.Conn != nil {
-				s.readChan <- payload{
-					socket: socket_nps,
-					data:   rawpayload,
-					ackId:  ackId,
-				}
-			}
-			// case protocol.BINARY_EVENT.String():
-			// 	socket_nps, err := s.Of(namespace).sockets.get(socket.Id)
-			// 	if err != nil {
-			// 		return err
-			// 	}
-			// 	log.Println("Debug: ", rawpayload)
-			// 	if socket.Conn != nil {
-			// 		s.readChan <- payload{
-			// 			socket: socket_nps,
-			// 			data:   rawpayload,
-			// 			ackId:  ackId,
-			// 		}
-			// 	}
-			// case protocol.BINARY_ACK.String():
+		if userId := socket_nps.UserID(); userId != "" {
+			nps.userJoin(userId, socket_nps)
 		}
-	case engineio.PING.String():
-		socket.engineWrite(engineio.PONG, map[string]interface{}{
-			"raw": anyAfterPacketType,
-		})
 
-		if socket.Conn != nil &&
-			socket.Conn.polling != nil {
-			socket.Conn.polling.Close()
+		for _, callback := range nps.connectionCallbacks() {
+			callback(socket_nps)
 		}
-	case engineio.CLOSE.String():
-		if socket.Conn != nil &&
-			socket.Conn.polling != nil {
-			socket.Conn.polling.Close()
+	case protocol.EVENT.String():
+		socket_nps, err := s.namespaceSocket(namespace, socket.Id)
+		if err != nil {
+			return err
+		}
+		if socket.conn() != nil {
+			s.dispatch(payload{
+				socket: socket_nps,
+				data:   rawpayload,
+				ackId:  ackId,
+			})
 		}
+	case protocol.BINARY_EVENT.String():
+		return s.handleBinaryEvent(socket, message)
 	}
 	return nil
 }
@@ -1,79 +1,125 @@
 package socketio
 
 import (
+	"context"
 	"errors"
-	"io"
 	"sync"
-	"time"
 
+	"github.com/doquangtan/socketio/v4/adapter"
 	"github.com/doquangtan/socketio/v4/engineio"
 	"github.com/doquangtan/socketio/v4/protocol"
-	"github.com/gofiber/websocket/v2"
-	gWebsocket "github.com/gorilla/websocket"
 )
 
 type Conn struct {
-	fasthttp *websocket.Conn
-	http     *gWebsocket.Conn
-	polling  *protocol.Polling
+	session *engineio.Session
+	queue   *sendQueue
+	// binary is the binary packet waiting for its attachments.
+	binary *binaryPacket
+
+	disconnect func(reason string)
+
+	inbound     chan payload
+	inboundOnce sync.Once
 }
 
-func (c *Conn) nextWriter(messageType int) (io.WriteCloser, error) {
-	if c.http != nil {
-		return c.http.NextWriter(messageType)
-	}
-	if c.fasthttp != nil {
-		return c.fasthttp.NextWriter(messageType)
+func newConn(session *engineio.Session, capacity int, policy SlowConsumerPolicy) *Conn {
+	c := &Conn{
+		session: session,
+		queue:   newSendQueue(capacity, policy),
 	}
-	if c.polling != nil {
-		return c.polling.NextWriter(messageType)
-	}
-	return nil, errors.New("not found http or fasthttp socket")
+	go c.writeLoop()
+	return c
 }
 
-func (c *Conn) setReadDeadline(t time.Time) error {
-	if c.http != nil {
-		return c.http.SetReadDeadline(t)
-	}
-	if c.fasthttp != nil {
-		return c.fasthttp.SetReadDeadline(t)
+func (c *Conn) writeLoop() {
+	for {
+		p, ok := c.queue.pop()
+		if !ok {
+			return
+		}
+		if c.queue.capacity > 0 {
+			// Hold packets in the queue while the poller is away so that the
+			// polling buffer stays bounded and the slow-consumer policy applies.
+			if !c.session.WaitBelow(c.queue.capacity, c.queue.done) {
+				return
+			}
+		}
+		c.session.WritePacket(p.data, !p.uncompressed)
+		for _, attachment := range p.attachments {
+			c.session.WriteBinary(attachment, !p.uncompressed)
+		}
+		if p.last {
+			c.queue.close()
+			c.session.Close()
+			return
+		}
 	}
-	return errors.New("not found http or fasthttp socket")
 }
 
+// close discards the queued packets and closes the session, unless
+// DisconnectWithReason is flushing them.
 func (c *Conn) close() {
-	if c.http != nil {
-		c.http.Close()
-	}
-	if c.fasthttp != nil {
-		c.fasthttp.Close()
-	}
-	if c.polling != nil {
-		c.polling.Close()
+	if c.queue.isSealed() {
+		return
 	}
+	c.queue.close()
+	c.session.Close()
 }
 
+// broadcastOperator targets either a fixed set of local sockets or, when nps
+// is set, the sockets of the namespace selected by opts on every node.
 type broadcastOperator struct {
+	nps     *Namespace
+	opts    adapter.BroadcastOptions
 	sockets *connections
 }
 
-func (c *broadcastOperator) Emit(event string, agrs ...interface{}) error {
-	for _, socket := range c.sockets.all() {
-		socket.Emit(event, agrs...)
+func newBroadcastOperator(sockets []*Socket) *broadcastOperator {
+	c := &broadcastOperator{
+		sockets: &connections{
+			conn: make(map[string]*Socket),
+		},
 	}
-	return nil
+	for _, socket := range sockets {
+		c.sockets.set(socket)
+	}
+	return c
+}
+
+// Volatile marks the packets as droppable when a recipient's send queue is
+// full and its policy is DropVolatile.
+func (c *broadcastOperator) Volatile() *broadcastOperator {
+	c.opts.Flags.Volatile = true
+	return c
+}
+
+// Compress(false) sends the packets without permessage-deflate compression,
+// e.g. for payloads that are already compressed.
+func (c *broadcastOperator) Compress(compress bool) *broadcastOperator {
+	c.opts.Flags.Uncompressed = !compress
+	return c
 }
 
 type Socket struct {
 	sync.RWMutex
-	Id               string
-	Nps              string
-	Conn             *Conn
-	Handshake        engineio.Handshake
-	rooms            roomNames
-	listeners        listeners
-	pingTime         time.Duration
-	dispose          []func()
+	Id        string
+	Nps       string
+	Conn      *Conn
+	Handshake engineio.Handshake
+	Data      *SocketData
+	rooms     roomNames
+	listeners listeners
+	reason    string
+	principal interface{}
+	userId    string
+	ctx       context.Context
+	cancel    context.CancelFunc
+	dispose   []func()
+	// leave removes the socket from its namespace, once.
+	leave func(reason string)
+	// left is set once the socket left its namespace, the connection staying
+	// open for the other namespaces.
+	left             bool
 	currentNamespace func() *Namespace
 	Join             func(room string)
 	Leave            func(room string)
@@ -85,7 +131,7 @@ func (s *Socket) On(event string, fn eventCallback) {
 }
 
 func (s *Socket) Emit(event string, agrs ...interface{}) error {
-	c := s.Conn
+	c := s.conn()
 	if c == nil {
 		return errors.New("socket has disconnected")
 	}
@@ -94,24 +140,32 @@ func (s *Socket) Emit(event string, agrs ...interface{}) error {
 }
 
 func (s *Socket) Broadcast() *broadcastOperator {
-	c := &broadcastOperator{
-		sockets: &connections{
-			conn: make(map[string]*Socket),
-		},
+	if s.currentNamespace == nil || s.currentNamespace() == nil {
+		return newBroadcastOperator(nil)
 	}
-	currentNps := s.currentNamespace()
-	if currentNps != nil {
-		for _, socket := range currentNps.sockets.all() {
-			if socket.Id != s.Id {
-				c.sockets.set(socket)
-			}
-		}
+	return s.currentNamespace().Except(s.Id)
+}
+
+// Volatile emits to this socket only, marking the packets as droppable.
+func (s *Socket) Volatile() *broadcastOperator {
+	return newBroadcastOperator([]*Socket{s}).Volatile()
+}
+
+// Compress emits to this socket only, see broadcastOperator.Compress.
+func (s *Socket) Compress(compress bool) *broadcastOperator {
+	return newBroadcastOperator([]*Socket{s}).Compress(compress)
+}
+
+func (s *Socket) SendQueueStats() SendQueueStats {
+	c := s.conn()
+	if c == nil {
+		return SendQueueStats{}
 	}
-	return c
+	return c.queue.stats()
 }
 
 func (s *Socket) ack(ackEvent string, agrs ...interface{}) error {
-	c := s.Conn
+	c := s.conn()
 	if c == nil {
 		return errors.New("socket has disconnected")
 	}
@@ -120,11 +174,11 @@ func (s *Socket) ack(ackEvent string, agrs ...interface{}) error {
 }
 
 func (s *Socket) Ping() error {
-	c := s.Conn
+	c := s.conn()
 	if c == nil {
 		return errors.New("socket has disconnected")
 	}
-	err := s.engineWrite(engineio.PING)
+	err := c.session.Ping()
 	if err != nil {
 		c.close()
 		return err
@@ -133,56 +187,149 @@ func (s *Socket) Ping() error {
 }
 
 func (s *Socket) Disconnect() error {
-	c := s.Conn
+	return s.DisconnectWithReason("server namespace disconnect")
+}
+
+// DisconnectWithReason closes the underlying connection once the packets
+// already emitted and a DISCONNECT packet are written. The reason is passed to
+// the "disconnect" handlers as the first data item.
+func (s *Socket) DisconnectWithReason(reason string) error {
+	c := s.conn()
 	if c == nil {
 		return errors.New("socket has disconnected")
 	}
-	s.writer(protocol.DISCONNECT)
-	return c.setReadDeadline(time.Now())
+	data, _ := protocol.Encode(protocol.DISCONNECT, s.npsPrefix())
+	c.queue.seal(outboundPacket{data: data, last: true})
+	if c.disconnect != nil {
+		c.disconnect(reason)
+		return nil
+	}
+	c.close()
+	return nil
 }
 
-func (s *Socket) Rooms() []string {
-	return s.rooms.all()
+// DisconnectNamespace sends a DISCONNECT packet for the namespace of the
+// socket and removes it from the namespace, running the "disconnect" handlers
+// with reason. Unlike DisconnectWithReason, the connection and the other
+// namespaces of the client stay open.
+func (s *Socket) DisconnectNamespace(reason string) error {
+	s.RLock()
+	leave, left := s.leave, s.left
+	s.RUnlock()
+	c := s.conn()
+	if c == nil || leave == nil || left {
+		return errors.New("socket has disconnected")
+	}
+	data, _ := protocol.Encode(protocol.DISCONNECT, s.npsPrefix())
+	if err := c.queue.push(outboundPacket{data: data}); err != nil {
+		return err
+	}
+	leave(reason)
+	return nil
 }
 
-func (s *Socket) disconnect() {
-	s.Conn.close()
-	s.Conn = nil
-	// s.rooms = []string{}
-	if len(s.dispose) > 0 {
-		for _, dispose := range s.dispose {
-			dispose()
-		}
+// Context is cancelled once the socket disconnects. Handler contexts returned
+// by EventPayload.Context are derived from it.
+func (s *Socket) Context() context.Context {
+	s.RLock()
+	defer s.RUnlock()
+	if s.ctx == nil {
+		return context.Background()
 	}
+	return s.ctx
 }
 
-func (s *Socket) engineWrite(t engineio.PacketType, arg ...interface{}) error {
+// WithValue attaches a value to the socket context, e.g. from a middleware,
+// so that it is visible to every later handler of the socket.
+func (s *Socket) WithValue(key, val interface{}) {
 	s.Lock()
 	defer s.Unlock()
-	w, err := s.Conn.nextWriter(websocket.TextMessage)
-	if err != nil {
-		return err
+	if s.ctx == nil {
+		s.ctx = context.Background()
 	}
-	engineio.WriteTo(w, t, arg...)
-	return w.Close()
+	s.ctx = context.WithValue(s.ctx, key, val)
 }
 
-func (s *Socket) writer(t protocol.PacketType, arg ...interface{}) error {
+// Principal returns what the namespace OnAuthenticate handler returned.
+func (s *Socket) Principal() interface{} {
+	s.RLock()
+	defer s.RUnlock()
+	return s.principal
+}
+
+// handshake reads the Handshake under the lock, as a CONNECT sets its Auth.
+func (s *Socket) handshake() engineio.Handshake {
+	s.RLock()
+	defer s.RUnlock()
+	return s.Handshake
+}
+
+func (s *Socket) Rooms() []string {
+	return s.rooms.all()
+}
+
+// conn returns the connection of the socket, nil once disconnected.
+func (s *Socket) conn() *Conn {
+	s.RLock()
+	defer s.RUnlock()
+	return s.Conn
+}
+
+func (s *Socket) disconnect() {
+	s.disconnectWithReason("transport close")
+}
+
+func (s *Socket) disconnectWithReason(reason string) {
 	s.Lock()
-	defer s.Unlock()
-	w, err := s.Conn.nextWriter(websocket.TextMessage)
-	if err != nil {
-		return err
+	c := s.Conn
+	s.Conn = nil
+	if c != nil {
+		s.reason = reason
+	}
+	s.Unlock()
+	if c == nil {
+		return
 	}
-	nps := ""
+	c.close()
+	for _, dispose := range s.dispose {
+		dispose()
+	}
+	if s.cancel != nil {
+		s.cancel()
+	}
+}
+
+func (s *Socket) send(p outboundPacket) error {
+	c := s.conn()
+	s.RLock()
+	left := s.left
+	s.RUnlock()
+	if c == nil || left {
+		return errors.New("socket has disconnected")
+	}
+	return c.queue.push(p)
+}
+
+func (s *Socket) npsPrefix() string {
 	if s.Nps != "/" {
-		nps = s.Nps + ","
+		return s.Nps + ","
 	}
+	return ""
+}
+
+func (s *Socket) writer(t protocol.PacketType, arg ...interface{}) error {
+	nps := s.npsPrefix()
+	ack := ""
 	if t == protocol.ACK {
-		agrs := append([]interface{}{}, arg[0].([]interface{})[1:])
-		protocol.WriteToWithAck(w, t, nps, arg[0].([]interface{})[0].(string), agrs...)
-	} else {
-		protocol.WriteTo(w, t, nps, arg...)
+		ack = arg[0].([]interface{})[0].(string)
+		arg = []interface{}{arg[0].([]interface{})[1:]}
+	}
+	data, attachments, err := protocol.EncodePacket(t, nps, ack, arg...)
+	if err != nil {
+		return err
 	}
-	return w.Close()
+	return s.send(outboundPacket{
+		data:        data,
+		attachments: attachments,
+	})
 }
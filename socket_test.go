@@ -0,0 +1,167 @@
+package socketio
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestDisconnectFlushesQueue(t *testing.T) {
+	io, srv := newTestServer(t, WithSendQueue(4, DisconnectSlowConsumer))
+	io.OnConnection(func(socket *Socket) {
+		socket.On("leave", func(event *EventPayload) {
+			for i := 0; i < 3; i++ {
+				socket.Emit("bye", i)
+			}
+			socket.Disconnect()
+			if err := socket.Emit("late"); err == nil {
+				t.Error("Emit after Disconnect succeeded")
+			}
+		})
+	})
+	c := dialTest(t, srv)
+	c.connect("/")
+	c.send(`42["leave"]`)
+	for i := 0; i < 3; i++ {
+		if got, want := c.read(), fmt.Sprintf(`42["bye",%d]`, i); got != want {
+			t.Fatalf("packet %d = %q, want %q", i, got, want)
+		}
+	}
+	if got := c.read(); got != "41" {
+		t.Fatalf("packet = %q, want DISCONNECT", got)
+	}
+	if !c.closed() {
+		t.Fatal("connection still open")
+	}
+}
+
+func TestSendQueueUnboundedByDefault(t *testing.T) {
+	io, _ := newTestServer(t)
+	if io.sendQueueCapacity != 0 {
+		t.Fatalf("default capacity = %d, want unbounded", io.sendQueueCapacity)
+	}
+}
+
+func TestDisconnectNamespace(t *testing.T) {
+	io, srv := newTestServer(t)
+	reasons := make(chan string, 1)
+	io.Of("/admin").OnConnection(func(socket *Socket) {
+		socket.On("disconnect", func(event *EventPayload) {
+			reasons <- event.Data[0].(string)
+		})
+		socket.On("leave", func(event *EventPayload) {
+			if err := socket.DisconnectNamespace("kicked"); err != nil {
+				t.Error(err)
+			}
+			if err := socket.Emit("late"); err == nil {
+				t.Error("Emit after DisconnectNamespace succeeded")
+			}
+			if err := socket.DisconnectNamespace("kicked"); err == nil {
+				t.Error("DisconnectNamespace succeeded twice")
+			}
+		})
+	})
+	io.OnConnection(func(socket *Socket) {
+		socket.On("ping", func(event *EventPayload) {
+			event.Ack("pong")
+		})
+	})
+	c := dialTest(t, srv)
+	c.connect("/")
+	c.connect("/admin")
+	c.send(`42/admin,["leave"]`)
+	if got := c.read(); got != "41/admin," {
+		t.Fatalf("packet = %q, want DISCONNECT of /admin", got)
+	}
+	if reason := <-reasons; reason != "kicked" {
+		t.Errorf("disconnect reason %q", reason)
+	}
+	if n := len(io.Of("/admin").Sockets()); n != 0 {
+		t.Errorf("%d sockets left in /admin", n)
+	}
+	// The connection and the main namespace stay open.
+	c.send(`421["ping"]`)
+	if got := c.read(); got != `431["pong"]` {
+		t.Fatalf("packet = %q, want the ack of ping", got)
+	}
+}
+
+func TestJoinConcurrently(t *testing.T) {
+	io, srv := newTestServer(t)
+	var joins, leaves int32
+	io.Of("/").Adapter().On("join-room", func(room string, id string) { atomic.AddInt32(&joins, 1) })
+	io.Of("/").Adapter().On("leave-room", func(room string, id string) { atomic.AddInt32(&leaves, 1) })
+	sockets := make(chan *Socket, 1)
+	io.OnConnection(func(socket *Socket) { sockets <- socket })
+	c := dialTest(t, srv)
+	c.connect("/")
+	socket := <-sockets
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			socket.Join("room1")
+		}()
+	}
+	wg.Wait()
+	if rooms := socket.Rooms(); len(rooms) != 1 || rooms[0] != "room1" {
+		t.Errorf("rooms %q", rooms)
+	}
+	if n := atomic.LoadInt32(&joins); n != 1 {
+		t.Errorf("%d join-room events", n)
+	}
+
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			socket.Leave("room1")
+		}()
+	}
+	wg.Wait()
+	if rooms := socket.Rooms(); len(rooms) != 0 {
+		t.Errorf("rooms %q after leaving", rooms)
+	}
+	if n := atomic.LoadInt32(&leaves); n != 1 {
+		t.Errorf("%d leave-room events", n)
+	}
+	if rooms := io.Of("/").Adapter().Rooms(); len(rooms) != 0 {
+		t.Errorf("adapter rooms %q", rooms)
+	}
+}
+
+func TestHandshakeAuth(t *testing.T) {
+	io, srv := newTestServer(t)
+	io.Of("/admin")
+	done := make(chan struct{})
+	fetched := make(chan struct{})
+	go func() {
+		defer close(fetched)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				io.FetchSockets()
+				io.Of("/admin").FetchSockets()
+			}
+		}
+	}()
+	c := dialTest(t, srv)
+	c.send(`40{"token":"root"}`)
+	c.read()
+	c.send(`40/admin,{"token":"admin"}`)
+	c.read()
+	close(done)
+	<-fetched
+
+	for nsp, want := range map[string]string{"/": "root", "/admin": "admin"} {
+		sockets := io.Of(nsp).FetchSockets()
+		if len(sockets) != 1 || sockets[0].Handshake.Auth["token"] != want {
+			t.Errorf("%s: sockets %+v", nsp, sockets)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package socketio
+
+import (
+	"sync"
+
+	"github.com/doquangtan/socketio/v4/adapter"
+)
+
+type users struct {
+	sync.RWMutex
+	list map[string]*connections
+}
+
+// add indexes the socket under its user and reports whether it is the
+// first socket of that user.
+func (u *users) add(userId string, socket *Socket) bool {
+	u.Lock()
+	defer u.Unlock()
+	sockets, ok := u.list[userId]
+	if !ok {
+		sockets = &connections{
+			conn: make(map[string]*Socket),
+		}
+		u.list[userId] = sockets
+	}
+	if _, err := sockets.get(socket.Id); err == nil {
+		return false
+	}
+	sockets.set(socket)
+	return !ok
+}
+
+// remove reports whether the socket was the last one of the user.
+func (u *users) remove(userId string, socket *Socket) bool {
+	u.Lock()
+	defer u.Unlock()
+	sockets, ok := u.list[userId]
+	if !ok {
+		return false
+	}
+	if _, err := sockets.get(socket.Id); err != nil {
+		return false
+	}
+	sockets.delete(socket.Id)
+	if len(sockets.all()) > 0 {
+		return false
+	}
+	delete(u.list, userId)
+	return true
+}
+
+func (u *users) get(userId string) []*Socket {
+	u.RLock()
+	defer u.RUnlock()
+	sockets, ok := u.list[userId]
+	if !ok {
+		return []*Socket{}
+	}
+	return sockets.all()
+}
+
+func (u *users) ids() []string {
+	u.RLock()
+	defer u.RUnlock()
+	ret := make([]string, 0, len(u.list))
+	for userId := range u.list {
+		ret = append(ret, userId)
+	}
+	return ret
+}
+
+// SetUserID binds the socket to a user, typically from an authentication
+// middleware, so that it can be reached with ToUser.
+func (s *Socket) SetUserID(userId string) {
+	s.Lock()
+	previous := s.userId
+	s.userId = userId
+	s.Unlock()
+	if previous == userId || s.currentNamespace == nil {
+		return
+	}
+	nps := s.currentNamespace()
+	if previous != "" {
+		nps.userLeave(previous, s)
+	}
+	if userId != "" {
+		nps.userJoin(userId, s)
+	}
+}
+
+func (s *Socket) UserID() string {
+	s.RLock()
+	defer s.RUnlock()
+	return s.userId
+}
+
+func (nps *Namespace) userJoin(userId string, socket *Socket) {
+	if nps.users.add(userId, socket) {
+		for _, callback := range nps.onConnection.get("user-online") {
+			callback(socket)
+		}
+	}
+}
+
+func (nps *Namespace) userLeave(userId string, socket *Socket) {
+	if nps.users.remove(userId, socket) {
+		for _, callback := range nps.onConnection.get("user-offline") {
+			callback(socket)
+		}
+	}
+}
+
+// OnUserOnline fires when the first socket of a user connects. The callback
+// receives that socket.
+func (nps *Namespace) OnUserOnline(fn connectionEventCallback) {
+	nps.onConnection.set("user-online", fn)
+}
+
+// OnUserOffline fires when the last socket of a user disconnects. The
+// callback receives that socket.
+func (nps *Namespace) OnUserOffline(fn connectionEventCallback) {
+	nps.onConnection.set("user-offline", fn)
+}
+
+func (nps *Namespace) ToUser(userId string) *broadcastOperator {
+	return nps.operator(adapter.BroadcastOptions{Users: []string{userId}})
+}
+
+func (nps *Namespace) UserSockets(userId string) []*Socket {
+	return nps.users.get(userId)
+}
+
+// OnlineUsers returns the ids of the users with at least one socket.
+func (nps *Namespace) OnlineUsers() []string {
+	return nps.users.ids()
+}
+
+func (nps *Namespace) DisconnectUser(userId string) {
+	for _, socket := range nps.users.get(userId) {
+		socket.Disconnect()
+	}
+}
+
+func (s *Io) ToUser(userId string) *broadcastOperator {
+	return s.Of("/").ToUser(userId)
+}
+
+func (s *Io) UserSockets(userId string) []*Socket {
+	return s.Of("/").UserSockets(userId)
+}
+
+func (s *Io) DisconnectUser(userId string) {
+	s.Of("/").DisconnectUser(userId)
+}